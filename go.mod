@@ -7,10 +7,10 @@ require (
 	github.com/stretchr/testify v1.7.0
 	github.com/tilotech/go-plugin v0.1.0
 	github.com/tilotech/tilores-plugin-api v0.7.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 )
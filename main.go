@@ -1,16 +1,509 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 
 	"github.com/tilotech/go-plugin"
+	api "github.com/tilotech/tilores-plugin-api"
 	"github.com/tilotech/tilores-plugin-api/dispatcher"
 	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg"
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg/generator"
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg/quality"
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg/webhook"
 )
 
 func main() {
-	err := plugin.ListenAndServe(dispatcher.Provide(&pkg.FakeDispatcher{}))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replay(os.Args[2:]))
+		case "generate":
+			os.Exit(generate(os.Args[2:]))
+		case "report":
+			os.Exit(report(os.Args[2:]))
+		case "export":
+			os.Exit(export(os.Args[2:]))
+		case "reload":
+			os.Exit(reload(os.Args[2:]))
+		case "metrics":
+			os.Exit(metrics(os.Args[2:]))
+		case "admin":
+			os.Exit(admin(os.Args[2:]))
+		}
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger, err := config.Logging.NewLogger(os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = serve(config, logger)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(1)
+	}
+}
+
+// serve configures the dispatcher based on the config and serves it as plugin
+// until the plugin is terminated
+func serve(config *pkg.Config, logger *pkg.Logger) error {
+	impl, fake, err := newDispatcher(config)
+	if err != nil {
+		return err
+	}
+	if fake != nil {
+		fake.OnError = func(err error) {
+			logger.Error(err, pkg.Field{Key: "component", Value: "fakeDispatcher"})
+		}
+	}
+	// with tenants, the admin methods, logs and webhooks only refer to the
+	// default tenant, if any
+	if auditFile := config.Persistence.AuditLog; auditFile != "" && fake != nil {
+		f, err := os.OpenFile(auditFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) // nolint:gosec
+		if err != nil {
+			return err
+		}
+		defer f.Close() // nolint:errcheck
+		fake.AuditLog = f
+	}
+	if eventFile := config.Persistence.EventLog; eventFile != "" && fake != nil {
+		f, err := os.OpenFile(eventFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) // nolint:gosec
+		if err != nil {
+			return err
+		}
+		defer f.Close() // nolint:errcheck
+		fake.EventLog = f
+	}
+	if webhookURL := config.Webhook.URL; webhookURL != "" && fake != nil {
+		w := &webhook.Webhook{
+			URL:    webhookURL,
+			Secret: config.Webhook.Secret,
+			OnError: func(err error) {
+				logger.Error(err, pkg.Field{Key: "component", Value: "webhook"})
+			},
+		}
+		go w.Run(context.Background(), fake) // nolint:errcheck
+	}
+	if recordFile := config.Persistence.Record; recordFile != "" {
+		f, err := os.OpenFile(recordFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) // nolint:gosec
+		if err != nil {
+			return err
+		}
+		defer f.Close() // nolint:errcheck
+		recorder := pkg.NewRecorder(impl, f)
+		recorder.OnError = func(err error) {
+			logger.Error(err, pkg.Field{Key: "component", Value: "recorder"})
+		}
+		impl = recorder
+	}
+	// injected faults are not recorded, so that a replay reproduces the
+	// responses of the fake dispatcher itself
+	if len(config.Faults) != 0 {
+		impl = pkg.NewFaultInjector(impl, config.Faults)
+	}
+	impl = pkg.NewCallLogger(impl, logger)
+
+	return plugin.ListenAndServe(pkg.NewAdminCallLogger(pkg.Provide(impl, fake), logger))
+}
+
+// loadConfig reads the config file from FAKE_DISPATCHER_CONFIG, if set, and
+// overrides its settings with the remaining environment variables
+//
+// The returned config is valid.
+func loadConfig() (*pkg.Config, error) {
+	config := &pkg.Config{}
+	if configFile := os.Getenv("FAKE_DISPATCHER_CONFIG"); configFile != "" {
+		var err error
+		config, err = pkg.LoadConfig(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FAKE_DISPATCHER_CONFIG: %w", err)
+		}
+	}
+
+	if value := os.Getenv("FAKE_DISPATCHER_CAPACITY"); value != "" {
+		var err error
+		config.Capacity, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FAKE_DISPATCHER_CAPACITY: %w", err)
+		}
+	}
+	if value := os.Getenv("FAKE_DISPATCHER_MAX_SEARCH_RESULTS"); value != "" {
+		var err error
+		config.MaxSearchResults, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FAKE_DISPATCHER_MAX_SEARCH_RESULTS: %w", err)
+		}
+	}
+	if value := os.Getenv("FAKE_DISPATCHER_RULES"); value != "" {
+		var err error
+		config.Rules, err = pkg.LoadRules(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FAKE_DISPATCHER_RULES: %w", err)
+		}
+	}
+	if value := os.Getenv("FAKE_DISPATCHER_STRICT_META"); value != "" {
+		var err error
+		config.StrictMeta, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FAKE_DISPATCHER_STRICT_META: %w", err)
+		}
+	}
+	overrides := map[string]*string{
+		"FAKE_DISPATCHER_SEARCH_MODE":    &config.SearchMode,
+		"FAKE_DISPATCHER_TENANTS":        &config.Tenants,
+		"FAKE_DISPATCHER_FIXTURES":       &config.Persistence.Fixtures,
+		"FAKE_DISPATCHER_RECORD":         &config.Persistence.Record,
+		"FAKE_DISPATCHER_AUDIT_LOG":      &config.Persistence.AuditLog,
+		"FAKE_DISPATCHER_EVENT_LOG":      &config.Persistence.EventLog,
+		"FAKE_DISPATCHER_WEBHOOK_URL":    &config.Webhook.URL,
+		"FAKE_DISPATCHER_WEBHOOK_SECRET": &config.Webhook.Secret,
+		"FAKE_DISPATCHER_LOG_LEVEL":      &config.Logging.Level,
+		"FAKE_DISPATCHER_LOG_FORMAT":     &config.Logging.Format,
+	}
+	for name, setting := range overrides {
+		if value := os.Getenv(name); value != "" {
+			*setting = value
+		}
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
+}
+
+// newDispatcher creates the dispatcher based on the config and submits the
+// fixtures, if any
+//
+// The returned fake is the fake dispatcher itself or the one of the default
+// tenant, which may be nil.
+func newDispatcher(config *pkg.Config) (dispatcher.Dispatcher, *pkg.FakeDispatcher, error) {
+	var impl dispatcher.Dispatcher
+	var fake *pkg.FakeDispatcher
+	if config.Tenants != "" {
+		tenants, err := pkg.LoadTenants(config.Tenants)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid tenants %v: %w", config.Tenants, err)
+		}
+		for _, tenant := range tenants.Dispatchers {
+			tenant.StrictMeta = config.StrictMeta
+			tenant.SearchMode = config.SearchMode
+		}
+		impl, fake = tenants, tenants.Dispatchers[tenants.Default]
+	} else {
+		fake = &pkg.FakeDispatcher{
+			Capacity:         config.Capacity,
+			Rules:            config.Rules,
+			MaxSearchResults: config.MaxSearchResults,
+			SearchMode:       config.SearchMode,
+			StrictMeta:       config.StrictMeta,
+		}
+		impl = fake
+	}
+
+	if fixtures := config.Persistence.Fixtures; fixtures != "" {
+		f, err := os.Open(fixtures) // nolint:gosec
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close() // nolint:errcheck
+		records, err := generator.ReadRecords(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid fixtures %v: %w", fixtures, err)
+		}
+		err = generator.Seed(context.Background(), impl, records, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return impl, fake, nil
+}
+
+// replay feeds a recorded session into a new fake dispatcher, configured the
+// same way as the plugin, and prints all responses that
+// differ from the recorded ones
+func replay(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("usage: replay <recorded-calls.jsonl>")
+		return 2
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer f.Close() // nolint:errcheck
+
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	impl, _, err := newDispatcher(config)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	mismatches, err := pkg.Replay(context.Background(), impl, f)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	for _, m := range mismatches {
+		fmt.Printf("line %v (%v):\n  expected: %v\n  actual:   %v\n", m.Line, m.Method, m.Expected, m.Actual)
+	}
+	if len(mismatches) != 0 {
+		return 1
+	}
+	return 0
+}
+
+// generate writes synthetic person records and their ground truth into files
+func generate(args []string) int {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	config := generator.Config{}
+	flags.IntVar(&config.Persons, "persons", 100, "number of distinct persons")
+	flags.Float64Var(&config.ExactDuplicateRate, "exact", 0.1, "rate of exact duplicates per person")
+	flags.Float64Var(&config.FuzzyDuplicateRate, "fuzzy", 0.1, "rate of fuzzy duplicates per person")
+	flags.Int64Var(&config.Seed, "seed", 1, "seed for the random generator")
+	recordsFile := flags.String("records", "records.jsonl", "output file for the records")
+	truthFile := flags.String("truth", "truth.json", "output file for the ground truth")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	result, err := generator.Generate(config)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	err = writeFile(*recordsFile, func(f *os.File) error {
+		return generator.WriteRecords(f, result.Records)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	err = writeFile(*truthFile, func(f *os.File) error {
+		return generator.WriteGroundTruth(f, result.GroundTruth)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf("generated %v records for %v persons\n", len(result.Records), config.Persons)
+	return 0
+}
+
+// report resolves the given records using the given rules and compares the
+// resulting entities with the ground truth
+func report(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	rulesFile := flags.String("rules", "rules.yaml", "rules file")
+	recordsFile := flags.String("records", "records.jsonl", "records file")
+	truthFile := flags.String("truth", "truth.json", "ground truth file")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	rules, err := pkg.LoadRules(*rulesFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	var records []*api.Record
+	err = readFile(*recordsFile, func(f *os.File) (err error) {
+		records, err = generator.ReadRecords(f)
+		return err
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	var groundTruth generator.GroundTruth
+	err = readFile(*truthFile, func(f *os.File) (err error) {
+		groundTruth, err = generator.ReadGroundTruth(f)
+		return err
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	fake := &pkg.FakeDispatcher{
+		Capacity: len(records),
+		Rules:    rules,
+	}
+	err = generator.Seed(context.Background(), fake, records, 0)
 	if err != nil {
 		fmt.Println(err)
+		return 1
+	}
+	result := quality.Evaluate(fake.Entities(), groundTruth)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(result)
+	} else {
+		err = result.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// export prints one or all entities of a running plugin as graph
+func export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	socket := flags.String("socket", filepath.Join(os.TempDir(), "dispatcher"), "socket of the running plugin")
+	input := &pkg.ExportInput{}
+	flags.StringVar(&input.EntityID, "entity", "", "entity ID to export, exports all entities if empty")
+	flags.StringVar(&input.Format, "format", "dot", "output format, one of dot, graphml or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	admin, err := pkg.ConnectAdmin(*socket)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	output, err := admin.Export(context.Background(), input)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Print(output.Graph)
+	return 0
+}
+
+// reload replaces the rules of a running plugin with the rules of a rules file
+// and prints the resulting entity changes
+func reload(args []string) int {
+	flags := flag.NewFlagSet("reload", flag.ContinueOnError)
+	socket := flags.String("socket", filepath.Join(os.TempDir(), "dispatcher"), "socket of the running plugin")
+	input := &pkg.ReloadInput{}
+	flags.BoolVar(&input.Recluster, "recluster", false, "recalculate the entities of all stored records")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("usage: reload [-socket <socket>] [-recluster] <rules.yaml>")
+		return 2
+	}
+	var err error
+	input.Rules, err = pkg.LoadRules(flags.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	admin, err := pkg.ConnectAdmin(*socket)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	output, err := admin.Reload(context.Background(), input)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(output)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// metrics prints the metrics of a running plugin in the Prometheus text format
+func metrics(args []string) int {
+	flags := flag.NewFlagSet("metrics", flag.ContinueOnError)
+	socket := flags.String("socket", filepath.Join(os.TempDir(), "dispatcher"), "socket of the running plugin")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	admin, err := pkg.ConnectAdmin(*socket)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	output, err := admin.Metrics(context.Background(), &pkg.MetricsInput{})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Print(output.Text)
+	return 0
+}
+
+// admin calls any admin method of a running plugin and prints the JSON response
+func admin(args []string) int {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	socket := flags.String("socket", filepath.Join(os.TempDir(), "dispatcher"), "socket of the running plugin")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Println("usage: admin [-socket <socket>] <method> [<json-input>]")
+		return 2
+	}
+	input := json.RawMessage("{}")
+	if flags.NArg() == 2 {
+		input = json.RawMessage(flags.Arg(1))
+	}
+
+	client, err := pkg.ConnectAdmin(*socket)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	var output json.RawMessage
+	err = client.Call(context.Background(), flags.Arg(0), input, &output)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Println(string(output))
+	return 0
+}
+
+func readFile(name string, read func(f *os.File) error) error {
+	f, err := os.Open(name) // nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint:errcheck
+	return read(f)
+}
+
+func writeFile(name string, write func(f *os.File) error) error {
+	f, err := os.Create(name) // nolint:gosec
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err != nil {
+		_ = f.Close()
+		return err
 	}
+	return f.Close()
 }
@@ -0,0 +1,215 @@
+package pkg
+
+import (
+	"context"
+
+	"github.com/tilotech/go-plugin"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// adminMethodPrefix is the common prefix of all admin methods
+const adminMethodPrefix = "/admin/"
+
+// admin methods that are provided in addition to the dispatcher methods
+const (
+	adminExportMethod        = "/admin/export"
+	adminEntityAtMethod      = "/admin/entityat"
+	adminRecordHistoryMethod = "/admin/recordhistory"
+	adminAuditMethod         = "/admin/audit"
+	adminEventsMethod        = "/admin/events"
+	adminMetricsMethod       = "/admin/metrics"
+	adminReloadMethod        = "/admin/reload"
+	adminDeleteRecordsMethod = "/admin/deleterecords"
+)
+
+// Provide returns the plugin.Provider for the dispatcher methods of impl and
+// the admin methods of fake.
+//
+// impl is usually the fake itself, but may also be a wrapper around the fake,
+// e.g. a Recorder. If fake is nil, no admin methods are provided.
+func Provide(impl dispatcher.Dispatcher, fake *FakeDispatcher) plugin.Provider {
+	return &provider{
+		dispatcher: dispatcher.Provide(impl),
+		fake:       fake,
+	}
+}
+
+type provider struct {
+	dispatcher plugin.Provider
+	fake       *FakeDispatcher
+}
+
+func (p *provider) Provide(method string) (plugin.RequestParameter, plugin.InvokeFunc, error) {
+	if p.fake == nil {
+		return p.dispatcher.Provide(method)
+	}
+	switch method {
+	case adminExportMethod:
+		return &ExportInput{}, p.Export, nil
+	case adminEntityAtMethod:
+		return &EntityAtInput{}, p.EntityAt, nil
+	case adminRecordHistoryMethod:
+		return &RecordHistoryInput{}, p.RecordHistory, nil
+	case adminAuditMethod:
+		return &AuditInput{}, p.Audit, nil
+	case adminEventsMethod:
+		return &EventsInput{}, p.Events, nil
+	case adminMetricsMethod:
+		return &MetricsInput{}, p.Metrics, nil
+	case adminReloadMethod:
+		return &ReloadInput{}, p.Reload, nil
+	case adminDeleteRecordsMethod:
+		return &DeleteRecordsInput{}, p.DeleteRecords, nil
+	}
+	return p.dispatcher.Provide(method)
+}
+
+func (p *provider) Export(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+	return p.fake.Export(ctx, params.(*ExportInput))
+}
+
+func (p *provider) EntityAt(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+	return p.fake.EntityAt(ctx, params.(*EntityAtInput))
+}
+
+func (p *provider) RecordHistory(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+	return p.fake.RecordHistory(ctx, params.(*RecordHistoryInput))
+}
+
+func (p *provider) Audit(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+	return p.fake.Audit(ctx, params.(*AuditInput))
+}
+
+func (p *provider) Events(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+	return p.fake.Events(ctx, params.(*EventsInput))
+}
+
+func (p *provider) Metrics(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+	return p.fake.Metrics(ctx, params.(*MetricsInput))
+}
+
+func (p *provider) Reload(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+	return p.fake.Reload(ctx, params.(*ReloadInput))
+}
+
+func (p *provider) DeleteRecords(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+	return p.fake.DeleteRecords(ctx, params.(*DeleteRecordsInput))
+}
+
+// Admin calls the admin methods of a running fake dispatcher plugin
+type Admin struct {
+	client *plugin.Client
+}
+
+// ConnectAdmin connects to the running fake dispatcher plugin that listens on
+// the given socket
+//
+// The plugin will neither be started nor terminated by the Admin.
+func ConnectAdmin(socket string) (*Admin, error) {
+	client, _, err := plugin.Start(&runningStarter{}, socket, plugin.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{
+		client: client,
+	}, nil
+}
+
+// Call invokes the admin method with the given name, e.g. "export"
+//
+// The response SHOULD be a non-nil pointer into which the response will be
+// unmarshalled.
+func (a *Admin) Call(ctx context.Context, method string, request, response interface{}) error {
+	return a.client.Call(ctx, adminMethodPrefix+method, request, response)
+}
+
+// Export exports one or all entities as graph
+func (a *Admin) Export(ctx context.Context, input *ExportInput) (*ExportOutput, error) {
+	response := &ExportOutput{}
+	err := a.client.Call(ctx, adminExportMethod, input, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// EntityAt returns the entity as it was at the given time
+func (a *Admin) EntityAt(ctx context.Context, input *EntityAtInput) (*dispatcher.EntityOutput, error) {
+	response := &dispatcher.EntityOutput{}
+	err := a.client.Call(ctx, adminEntityAtMethod, input, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// RecordHistory returns all versions of a record and the entities it belonged to
+func (a *Admin) RecordHistory(ctx context.Context, input *RecordHistoryInput) (*RecordHistoryOutput, error) {
+	response := &RecordHistoryOutput{}
+	err := a.client.Call(ctx, adminRecordHistoryMethod, input, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Audit returns the audit trail of all Disassemble and RemoveConnectionBan calls
+func (a *Admin) Audit(ctx context.Context, input *AuditInput) (*AuditOutput, error) {
+	response := &AuditOutput{}
+	err := a.client.Call(ctx, adminAuditMethod, input, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Events returns the events after the given cursor, waiting for new events if
+// requested
+func (a *Admin) Events(ctx context.Context, input *EventsInput) (*EventsOutput, error) {
+	response := &EventsOutput{}
+	err := a.client.Call(ctx, adminEventsMethod, input, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Metrics returns the metrics in the Prometheus text format
+func (a *Admin) Metrics(ctx context.Context, input *MetricsInput) (*MetricsOutput, error) {
+	response := &MetricsOutput{}
+	err := a.client.Call(ctx, adminMetricsMethod, input, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Reload replaces the rules, optionally reclustering all stored records
+func (a *Admin) Reload(ctx context.Context, input *ReloadInput) (*ReloadOutput, error) {
+	response := &ReloadOutput{}
+	err := a.client.Call(ctx, adminReloadMethod, input, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// DeleteRecords hard deletes records by ID or by a data predicate
+func (a *Admin) DeleteRecords(ctx context.Context, input *DeleteRecordsInput) (*DeleteRecordsOutput, error) {
+	response := &DeleteRecordsOutput{}
+	err := a.client.Call(ctx, adminDeleteRecordsMethod, input, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// runningStarter is a plugin.Starter for plugins that are already running
+type runningStarter struct{}
+
+func (s *runningStarter) Start(_ string, _ chan<- struct{}, ready chan<- struct{}) (plugin.TermFunc, error) {
+	ready <- struct{}{}
+	return func() error {
+		return nil
+	}, nil
+}
@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// audited actions
+const (
+	AuditActionDisassemble         = "disassemble"
+	AuditActionRemoveConnectionBan = "removeConnectionBan"
+)
+
+// AuditEntry describes a single Disassemble or RemoveConnectionBan call, who
+// triggered it and why
+type AuditEntry struct {
+	Time                time.Time                    `json:"time"`
+	Action              string                       `json:"action"`
+	Reference           string                       `json:"reference"`
+	User                string                       `json:"user"`
+	Reason              string                       `json:"reason"`
+	Edges               []dispatcher.DisassembleEdge `json:"edges,omitempty"`
+	RecordIDs           []string                     `json:"recordIDs,omitempty"`
+	CreateConnectionBan bool                         `json:"createConnectionBan,omitempty"`
+	DeletedEdges        int32                        `json:"deletedEdges"`
+	DeletedRecords      int32                        `json:"deletedRecords"`
+	EntityIDs           []string                     `json:"entityIDs"`       // affected entities before the action
+	ResultEntityIDs     []string                     `json:"resultEntityIDs"` // affected entities after the action
+}
+
+// AuditInput includes the data required to query the audit trail
+type AuditInput struct {
+	Reference string `json:"reference"` // optional, returns all entries if empty
+}
+
+// AuditOutput contains the audit entries ordered from oldest to newest
+type AuditOutput struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// Audit returns the audit trail of all successful Disassemble and
+// RemoveConnectionBan calls
+func (f *FakeDispatcher) Audit(_ context.Context, input *AuditInput) (*AuditOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	output := &AuditOutput{
+		Entries: make([]AuditEntry, 0, len(f.audit)),
+	}
+	for _, entry := range f.audit {
+		if input.Reference == "" || entry.Reference == input.Reference {
+			output.Entries = append(output.Entries, entry)
+		}
+	}
+	return output, nil
+}
+
+// writeAudit adds the entry to the audit trail and writes it to the audit log
+//
+// Since the audited call already modified the dispatcher, errors while writing
+// are passed to OnError instead of failing the call.
+func (f *FakeDispatcher) writeAudit(entry AuditEntry) {
+	f.audit = append(f.audit, entry)
+	if f.AuditLog == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = f.AuditLog.Write(append(line, '\n'))
+	}
+	if err != nil {
+		f.reportError(fmt.Errorf("failed to write audit log: %w", err))
+	}
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestAudit(t *testing.T) {
+	clock := &testClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	log := &bytes.Buffer{}
+	fixture := &FakeDispatcher{Rules: testRules, AuditLog: log, now: clock.Now}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	entityID := fixture.Entities()[0].ID
+
+	t1 := clock.tick()
+	output, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Reference:           "ref-1",
+		Edges:               []dispatcher.DisassembleEdge{{A: "A", B: "B"}},
+		CreateConnectionBan: true,
+		Meta:                dispatcher.DisassembleMeta{User: "jane", Reason: "different persons"},
+	})
+	assert.NoError(t, err)
+
+	t2 := clock.tick()
+	err = fixture.RemoveConnectionBan(ctx, &dispatcher.RemoveConnectionBanInput{
+		Reference: "ref-2",
+		EntityID:  output.EntityIDs[0],
+		Others:    []string{output.EntityIDs[1]},
+		Meta:      dispatcher.RemoveConnectionBanMeta{User: "john", Reason: "same person after all"},
+	})
+	assert.NoError(t, err)
+
+	_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{Reference: "ref-3", RecordIDs: []string{"unknown"}})
+	assert.Error(t, err)
+
+	expected := []AuditEntry{
+		{
+			Time:                t1,
+			Action:              AuditActionDisassemble,
+			Reference:           "ref-1",
+			User:                "jane",
+			Reason:              "different persons",
+			Edges:               []dispatcher.DisassembleEdge{{A: "A", B: "B"}},
+			CreateConnectionBan: true,
+			DeletedEdges:        1,
+			EntityIDs:           []string{entityID},
+			ResultEntityIDs:     output.EntityIDs,
+		},
+		{
+			Time:            t2,
+			Action:          AuditActionRemoveConnectionBan,
+			Reference:       "ref-2",
+			User:            "john",
+			Reason:          "same person after all",
+			EntityIDs:       output.EntityIDs,
+			ResultEntityIDs: []string{entityID},
+		},
+	}
+	actual, err := fixture.Audit(ctx, &AuditInput{})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual.Entries)
+
+	actual, err = fixture.Audit(ctx, &AuditInput{Reference: "ref-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, expected[1:], actual.Entries)
+
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], `"user":"jane"`)
+		assert.Contains(t, lines[1], `"action":"removeConnectionBan"`)
+	}
+}
+
+func TestAuditLogFailure(t *testing.T) {
+	errs := []error{}
+	fixture := &FakeDispatcher{AuditLog: failingWriter{}, OnError: func(err error) {
+		errs = append(errs, err)
+	}}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(record("1")))
+	assert.NoError(t, err)
+
+	output, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{RecordIDs: []string{"1"}})
+	assert.NoError(t, err, "the records are already removed")
+	assert.Equal(t, int32(1), output.DeletedRecords)
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "failed to write audit log: disk full")
+	}
+
+	actual, err := fixture.Audit(ctx, &AuditInput{})
+	assert.NoError(t, err)
+	assert.Len(t, actual.Entries, 1)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// blockingPart is a part of a blocking key, which uses the value of a field,
+// optionally shortened to its first characters
+type blockingPart struct {
+	field  string
+	length int
+}
+
+// parseBlockingPart parses a blocking key part, which is a field optionally
+// followed by a colon and the number of leading characters, e.g. lastName:3
+func parseBlockingPart(spec string) (blockingPart, error) {
+	part := blockingPart{field: spec}
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		length, err := strconv.Atoi(spec[i+1:])
+		if err != nil || length <= 0 {
+			return blockingPart{}, fmt.Errorf("length %v must be a positive number", spec[i+1:])
+		}
+		part = blockingPart{field: spec[:i], length: length}
+	}
+	if part.field == "" {
+		return blockingPart{}, fmt.Errorf("field must not be empty")
+	}
+	return part, nil
+}
+
+// blockingKey defines the blocking key of a rule by its parsed parts
+type blockingKey struct {
+	parts []blockingPart
+
+	// invalid is set if any part could not be parsed, e.g. for rules that
+	// were not validated, in which case records never share a block
+	invalid bool
+}
+
+// newBlockingKey parses the blocking key parts of a rule
+func newBlockingKey(specs []string) blockingKey {
+	key := blockingKey{parts: make([]blockingPart, 0, len(specs))}
+	for _, spec := range specs {
+		part, err := parseBlockingPart(spec)
+		if err != nil {
+			return blockingKey{invalid: true}
+		}
+		key.parts = append(key.parts, part)
+	}
+	return key
+}
+
+// keys returns the blocking keys of the record data
+//
+// Without blocking key parts, all records share the same empty key. Records
+// without a value for any of the parts have no keys, records with multiple
+// values have a key for each combination of values.
+func (k blockingKey) keys(data map[string]interface{}) []string {
+	if k.invalid {
+		return nil
+	}
+	keys := []string{""}
+	for i, part := range k.parts {
+		values := part.values(data[part.field])
+		combined := make([]string, 0, len(keys)*len(values))
+		for _, key := range keys {
+			for _, value := range values {
+				if i > 0 {
+					value = key + "\x00" + value
+				}
+				combined = append(combined, value)
+			}
+		}
+		keys = combined
+	}
+	return keys
+}
+
+// values returns the normalized and shortened values for the part
+func (p blockingPart) values(value interface{}) []string {
+	if values, ok := elements(value); ok {
+		result := make([]string, 0, len(values))
+		for _, v := range values {
+			result = append(result, p.values(v)...)
+		}
+		return result
+	}
+	s := ""
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		s = normalizeText(v)
+	case float64:
+		s = formatFloat(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" {
+		return nil
+	}
+	if runes := []rune(s); p.length > 0 && len(runes) > p.length {
+		s = string(runes[:p.length])
+	}
+	return []string{s}
+}
+
+// shared returns true if a and b have any blocking key in common
+func (k blockingKey) shared(a, b map[string]interface{}) bool {
+	if len(k.parts) == 0 && !k.invalid {
+		return true
+	}
+	keysA := k.keys(a)
+	for _, key := range k.keys(b) {
+		if contains(keysA, key) {
+			return true
+		}
+	}
+	return false
+}
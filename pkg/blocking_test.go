@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg/generator"
+)
+
+func TestBlockingKeys(t *testing.T) {
+	cases := map[string]struct {
+		blocking []string
+		data     map[string]interface{}
+		expected []string
+	}{
+		"no blocking": {
+			data:     map[string]interface{}{},
+			expected: []string{""},
+		},
+		"prefix and field": {
+			blocking: []string{"lastName:3", "zip"},
+			data:     map[string]interface{}{"lastName": " Smith", "zip": "12345"},
+			expected: []string{"smi\x0012345"},
+		},
+		"short value": {
+			blocking: []string{"lastName:3"},
+			data:     map[string]interface{}{"lastName": "Li"},
+			expected: []string{"li"},
+		},
+		"unicode": {
+			blocking: []string{"lastName:3"},
+			data:     map[string]interface{}{"lastName": "Müller"},
+			expected: []string{"mül"},
+		},
+		"number": {
+			blocking: []string{"zip"},
+			data:     map[string]interface{}{"zip": 12345.0},
+			expected: []string{"12345"},
+		},
+		"multiple values": {
+			blocking: []string{"lastName:1", "zip"},
+			data: map[string]interface{}{
+				"lastName": []interface{}{"Smith", "Doe"},
+				"zip":      []interface{}{"1", "2"},
+			},
+			expected: []string{"s\x001", "s\x002", "d\x001", "d\x002"},
+		},
+		"missing value": {
+			blocking: []string{"lastName:3", "zip"},
+			data:     map[string]interface{}{"lastName": "Smith"},
+			expected: []string{},
+		},
+		"empty value": {
+			blocking: []string{"lastName:3"},
+			data:     map[string]interface{}{"lastName": " "},
+			expected: []string{},
+		},
+		"invalid part": {
+			blocking: []string{"lastName:0"},
+			data:     map[string]interface{}{"lastName": "Smith"},
+			expected: nil,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, newBlockingKey(c.blocking).keys(c.data))
+		})
+	}
+}
+
+func TestBlocking(t *testing.T) {
+	fixture := &FakeDispatcher{
+		Capacity: 100,
+		Rules: []Rule{
+			{ID: "R1", Fields: []string{"firstName"}, Blocking: []string{"lastName:3", "zip"}},
+			{ID: "R2", Fields: []string{"email"}, Blocking: []string{"email"}},
+		},
+	}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		address("A", "Anna", "Smith", "12345"),
+		address("B", "Anna", "Smithers", "12345"),
+		address("C", "Anna", "Smith", "54321"),
+		address("D", "Anna", "Doe", "12345"),
+		&api.Record{ID: "E", Data: map[string]interface{}{"firstName": "Anna", "email": "anna@example.com"}},
+		&api.Record{ID: "F", Data: map[string]interface{}{"email": []interface{}{"a@example.com", "anna@example.com"}}},
+	))
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+	if assert.Len(t, entities, 4) {
+		assert.Equal(t, []string{"A", "B"}, ids(entities[0].Records))
+		assert.Equal(t, api.Edges{"A:B:R1"}, entities[0].Edges)
+		assert.Equal(t, []string{"C"}, ids(entities[1].Records))
+		assert.Equal(t, []string{"D"}, ids(entities[2].Records))
+		assert.Equal(t, []string{"E", "F"}, ids(entities[3].Records))
+	}
+
+	// removing records must remove them from their blocks as well
+	_, err = fixture.Submit(ctx, createSubmitInput(address("B", "Anna", "Doe", "12345")))
+	assert.NoError(t, err)
+	entities = fixture.Entities()
+	if assert.Len(t, entities, 4) {
+		assert.Equal(t, []string{"A"}, ids(entities[0].Records))
+		assert.Equal(t, []string{"D", "B"}, ids(entities[2].Records))
+	}
+
+	_, err = fixture.Reload(ctx, &ReloadInput{
+		Rules:     []Rule{{ID: "R1", Fields: []string{"firstName"}, Blocking: []string{"zip"}}},
+		Recluster: true,
+	})
+	assert.NoError(t, err)
+	entities = fixture.Entities()
+	if assert.Len(t, entities, 4) {
+		assert.Equal(t, []string{"A", "D", "B"}, ids(entities[0].Records))
+		assert.Equal(t, []string{"C"}, ids(entities[1].Records))
+		assert.Equal(t, []string{"E"}, ids(entities[2].Records))
+		assert.Equal(t, []string{"F"}, ids(entities[3].Records))
+	}
+
+	// without reclustering, the new blocks apply to records submitted later
+	_, err = fixture.Reload(ctx, &ReloadInput{
+		Rules: []Rule{{ID: "R1", Fields: []string{"firstName"}, Blocking: []string{"lastName:3"}}},
+	})
+	assert.NoError(t, err)
+	_, err = fixture.Submit(ctx, createSubmitInput(address("G", "Anna", "Smith", "99999")))
+	assert.NoError(t, err)
+	entities = fixture.Entities()
+	if assert.Len(t, entities, 3) {
+		assert.Equal(t, []string{"A", "C", "D", "B", "G"}, ids(entities[0].Records))
+		assert.Equal(t, api.Edges{"A:D:R1", "A:B:R1", "A:G:R1", "C:G:R1", "D:B:R1"}, entities[0].Edges)
+	}
+}
+
+func address(id, firstName, lastName, zip string) *api.Record {
+	return &api.Record{
+		ID: id,
+		Data: map[string]interface{}{
+			"firstName": firstName,
+			"lastName":  lastName,
+			"zip":       zip,
+		},
+	}
+}
+
+// benchWithoutBlocking enables benchmarking Submit without blocking, which
+// takes about a minute per operation
+var benchWithoutBlocking = flag.Bool("bench-without-blocking", false, "benchmark Submit without blocking as well")
+
+// BenchmarkSubmit measures submitting the given number of records in a single
+// call into an empty store
+//
+// Without blocking, all pairs of records are compared, therefore it is only
+// benchmarked with 10k records and only if enabled using the flag
+// -bench-without-blocking.
+func BenchmarkSubmit(b *testing.B) {
+	cases := []struct {
+		records  int
+		blocking bool
+	}{
+		{records: 10000, blocking: false},
+		{records: 10000, blocking: true},
+		{records: 100000, blocking: true},
+	}
+	for _, c := range cases {
+		b.Run(fmt.Sprintf("records=%v/blocking=%v", c.records, c.blocking), func(b *testing.B) {
+			if !c.blocking && !*benchWithoutBlocking {
+				b.Skip("enable with -bench-without-blocking")
+			}
+			rules := benchmarkRules(c.blocking)
+			input := createSubmitInput(benchmarkRecords(b, c.records)...)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				fixture := &FakeDispatcher{Capacity: c.records, Rules: rules}
+				_, err := fixture.Submit(ctx, input)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSubmitSingle measures submitting a single record per call into a
+// store that already contains the given number of records
+//
+// With blocking, the cost per call should barely depend on the number of stored
+// records, since only the affected entities are rebuilt.
+func BenchmarkSubmitSingle(b *testing.B) {
+	for _, stored := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("stored=%v", stored), func(b *testing.B) {
+			records := benchmarkRecords(b, stored+1000)
+			fixture := &FakeDispatcher{Capacity: len(records), Rules: benchmarkRules(true)}
+			ctx := context.Background()
+			_, err := fixture.Submit(ctx, createSubmitInput(records[:stored]...))
+			if err != nil {
+				b.Fatal(err)
+			}
+			additional := records[stored:]
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				record := additional[i%len(additional)]
+				_, err = fixture.Submit(ctx, createSubmitInput(&api.Record{
+					ID:   fmt.Sprintf("single-%v", i),
+					Data: record.Data,
+				}))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkRules returns rules for generated persons, optionally with blocking
+// keys that contain the matched fields, so that most blocks are small
+func benchmarkRules(blocking bool) []Rule {
+	rules := []Rule{
+		{ID: "R1", Fields: []string{"firstName", "lastName", "dateOfBirth"}},
+		{ID: "R2", Fields: []string{"email"}},
+	}
+	if blocking {
+		rules[0].Blocking = []string{"lastName:3", "dateOfBirth"}
+		rules[1].Blocking = []string{"email"}
+	}
+	return rules
+}
+
+func benchmarkRecords(b *testing.B, n int) []*api.Record {
+	generated, err := generator.Generate(generator.Config{
+		Persons:            n,
+		ExactDuplicateRate: 0.1,
+		FuzzyDuplicateRate: 0.1,
+		Seed:               1,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return generated.Records[:n]
+}
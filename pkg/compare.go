@@ -0,0 +1,272 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// comparators that can be used in rules, optionally followed by a colon and a
+// comma separated list of arguments, e.g. "date:1,swap"
+const (
+	// CompareText matches texts ignoring their case and whitespace
+	CompareText = "text"
+
+	// CompareDate matches dates in different formats on the same day, the
+	// arguments can define a tolerance in days and enable the detection of
+	// swapped days and months ("swap")
+	CompareDate = "date"
+
+	// ComparePhone matches phone numbers ignoring their formatting, the
+	// optional argument is the country calling code for national numbers
+	ComparePhone = "phone"
+
+	// CompareAddress matches postal addresses ignoring their casing,
+	// punctuation, street abbreviations and the position of the house number
+	CompareAddress = "address"
+
+	// CompareEmail matches email addresses ignoring their casing, the
+	// arguments are the domains that ignore dots and plus tags in the local part
+	CompareEmail = "email"
+)
+
+// match describes how well two values match
+type match int
+
+const (
+	noMatch match = iota
+	fuzzyMatch
+	exactMatch
+)
+
+// comparator returns true if both values are similar
+type comparator func(a, b interface{}) bool
+
+// comparators contains a constructor for each comparator, which receives the
+// arguments of the comparator
+var comparators = map[string]func(args []string) (comparator, error){
+	CompareText:    newTextComparator,
+	CompareDate:    newDateComparator,
+	ComparePhone:   newPhoneComparator,
+	CompareAddress: newAddressComparator,
+	CompareEmail:   newEmailComparator,
+}
+
+// parsedComparators caches the comparator for each valid specification
+var parsedComparators sync.Map
+
+// parseComparator returns the comparator for the given specification, which
+// is the name of the comparator, optionally followed by its arguments
+func parseComparator(spec string) (comparator, error) {
+	if c, ok := parsedComparators.Load(spec); ok {
+		return c.(comparator), nil
+	}
+	name, arguments := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, arguments = spec[:i], spec[i+1:]
+	}
+	newComparator, ok := comparators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown comparator %v", name)
+	}
+	args := []string{}
+	if arguments != "" {
+		args = strings.Split(arguments, ",")
+	}
+	c, err := newComparator(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid comparator %v: %w", spec, err)
+	}
+	parsedComparators.Store(spec, c)
+	return c, nil
+}
+
+// compare returns an exact match for equal values and a fuzzy match for values
+// that the comparator with the given specification considers similar
+//
+// If a is a search condition, it is an exact match if b satisfies it, see
+// condition for how conditions match slices. Otherwise, equal slices match
+// exactly, while other slices are treated as sets of values, which match if any
+// of their elements match.
+func compare(spec string, a, b interface{}) match {
+	if c, ok := a.(*condition); ok {
+		if c.matches(b) {
+			return exactMatch
+		}
+		return noMatch
+	}
+	if equal(a, b) {
+		return exactMatch
+	}
+	if values, ok := elements(b); ok {
+		return compareAny(values, func(v interface{}) match {
+			return compare(spec, a, v)
+		})
+	}
+	if values, ok := elements(a); ok {
+		return compareAny(values, func(v interface{}) match {
+			return compare(spec, v, b)
+		})
+	}
+	if a == nil || b == nil || spec == "" {
+		return noMatch
+	}
+	if c, err := parseComparator(spec); err == nil && c(a, b) {
+		return fuzzyMatch
+	}
+	return noMatch
+}
+
+// compareAny returns the best match of any of the values
+func compareAny(values []interface{}, compare func(v interface{}) match) match {
+	best := noMatch
+	for _, v := range values {
+		if m := compare(v); m > best {
+			best = m
+			if best == exactMatch {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// elements returns the elements of the value if it is a slice
+func elements(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []string:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = v[i]
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func newTextComparator(args []string) (comparator, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("no arguments supported")
+	}
+	return normalizedComparator(normalizeText), nil
+}
+
+// normalizedComparator returns a comparator for strings that are similar if
+// their normalized values are equal and not empty
+func normalizedComparator(normalize func(s string) string) comparator {
+	return func(a, b interface{}) bool {
+		textA, ok := a.(string)
+		if !ok {
+			return false
+		}
+		textB, ok := b.(string)
+		if !ok {
+			return false
+		}
+		normalized := normalize(textA)
+		return normalized != "" && normalized == normalize(textB)
+	}
+}
+
+// normalizeText returns the lower case text with single spaces between words
+func normalizeText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// dateLayouts are the supported date formats, where dates with slashes are
+// assumed to be month first
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006/01/02",
+	"20060102",
+	"02.01.2006",
+	"2.1.2006",
+	"01/02/2006",
+	"1/2/2006",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+func newDateComparator(args []string) (comparator, error) {
+	tolerance := 0
+	swap := false
+	for _, arg := range args {
+		if arg == "swap" {
+			swap = true
+			continue
+		}
+		days, err := strconv.Atoi(arg)
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("argument %v must be swap or a tolerance in days", arg)
+		}
+		tolerance = days
+	}
+	return func(a, b interface{}) bool {
+		dayA, ok := parseDay(a)
+		if !ok {
+			return false
+		}
+		dayB, ok := parseDay(b)
+		if !ok {
+			return false
+		}
+		if abs(dayA.days()-dayB.days()) <= tolerance {
+			return true
+		}
+		return swap && dayA.swapped().days() == dayB.days()
+	}, nil
+}
+
+// day is a calendar day without time zone
+type day struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+// parseDay returns the day of a date in any of the supported formats
+func parseDay(value interface{}) (day, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return day{}, false
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			year, month, d := t.Date()
+			return day{year: year, month: month, day: d}, true
+		}
+	}
+	return day{}, false
+}
+
+// days returns the number of days since the Unix epoch
+func (d day) days() int {
+	return int(time.Date(d.year, d.month, d.day, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// swapped returns the day with day and month swapped, or the day itself if
+// they cannot be swapped
+func (d day) swapped() day {
+	if d.day > 12 {
+		return d
+	}
+	return day{year: d.year, month: time.Month(d.day), day: int(d.month)}
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,171 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestCompareDate(t *testing.T) {
+	cases := map[string]struct {
+		spec     string
+		a        interface{}
+		b        interface{}
+		expected match
+	}{
+		"equal":                  {spec: "date", a: "1990-04-01", b: "1990-04-01", expected: exactMatch},
+		"ISO and German":         {spec: "date", a: "1990-04-01", b: "01.04.1990", expected: fuzzyMatch},
+		"ISO and US":             {spec: "date", a: "1990-04-01", b: "4/1/1990", expected: fuzzyMatch},
+		"ISO and text":           {spec: "date", a: "1990-04-01", b: "April 1, 1990", expected: fuzzyMatch},
+		"timestamp":              {spec: "date", a: "1990-04-01T23:30:00+02:00", b: "19900401", expected: fuzzyMatch},
+		"different day":          {spec: "date", a: "1990-04-01", b: "1990-04-02", expected: noMatch},
+		"within tolerance":       {spec: "date:1", a: "1990-04-01", b: "1990-03-31", expected: fuzzyMatch},
+		"outside tolerance":      {spec: "date:1", a: "1990-04-01", b: "1990-04-03", expected: noMatch},
+		"tolerance across years": {spec: "date:2", a: "1989-12-31", b: "02.01.1990", expected: fuzzyMatch},
+		"swapped":                {spec: "date:swap", a: "1990-04-01", b: "1990-01-04", expected: fuzzyMatch},
+		"swapped EU and US":      {spec: "date:swap", a: "01/04/1990", b: "01.04.1990", expected: fuzzyMatch},
+		"swap not enabled":       {spec: "date:1", a: "1990-04-01", b: "1990-01-04", expected: noMatch},
+		"swap impossible":        {spec: "date:swap", a: "1990-04-13", b: "1990-12-04", expected: noMatch},
+		"not a date":             {spec: "date", a: "1990-04-01", b: "yesterday", expected: noMatch},
+		"not a string":           {spec: "date", a: "1990-04-01", b: 19900401.0, expected: noMatch},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, compare(c.spec, c.a, c.b))
+			assert.Equal(t, c.expected, compare(c.spec, c.b, c.a), "comparison must be symmetric")
+		})
+	}
+}
+
+func TestCompareText(t *testing.T) {
+	assert.Equal(t, fuzzyMatch, compare(CompareText, "Anna  Smith ", "anna smith"))
+	assert.Equal(t, noMatch, compare(CompareText, "Anna Smith", "Anna Smyth"))
+	assert.Equal(t, noMatch, compare("", "Anna", "anna"))
+
+	_, err := parseComparator("text:1")
+	assert.EqualError(t, err, "invalid comparator text:1: no arguments supported")
+}
+
+func TestDateRules(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: []Rule{
+		{ID: "R1", Fields: []string{"lastName", "dateOfBirth"}, Compare: map[string]string{"dateOfBirth": "date:swap"}},
+	}}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		&api.Record{ID: "A", Data: map[string]interface{}{"lastName": "Smith", "dateOfBirth": "1990-04-01"}},
+		&api.Record{ID: "B", Data: map[string]interface{}{"lastName": "Smith", "dateOfBirth": "01.04.1990"}},
+		&api.Record{ID: "C", Data: map[string]interface{}{"lastName": "Smith", "dateOfBirth": "1990-04-02"}},
+	))
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+	if assert.Len(t, entities, 2) {
+		assert.Equal(t, []string{"A", "B"}, ids(entities[0].Records))
+	}
+
+	output, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"lastName":    "Smith",
+		"dateOfBirth": "1990-01-04",
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Entities, 1) {
+		assert.Equal(t, []string{"A", "B"}, ids(output.Entities[0].Records))
+	}
+}
+
+func TestCompareMultipleValues(t *testing.T) {
+	emails := []interface{}{"anna@example.com", "Anna.Smith@Example.com"}
+	cases := map[string]struct {
+		spec     string
+		a        interface{}
+		b        interface{}
+		expected match
+	}{
+		"any element":         {a: emails, b: "anna@example.com", expected: exactMatch},
+		"no element":          {a: emails, b: "bob@example.com", expected: noMatch},
+		"common element":      {a: emails, b: []interface{}{"bob@example.com", "anna@example.com"}, expected: exactMatch},
+		"no common element":   {a: emails, b: []interface{}{"bob@example.com"}, expected: noMatch},
+		"string slice":        {a: []string{"a", "b"}, b: "b", expected: exactMatch},
+		"empty":               {a: []interface{}{}, b: []interface{}{}, expected: exactMatch},
+		"empty and value":     {a: []interface{}{}, b: "a", expected: noMatch},
+		"equal slices":        {a: []interface{}{"a", "b"}, b: []interface{}{"a", "b"}, expected: exactMatch},
+		"best element":        {spec: "text", a: emails, b: []interface{}{"anna.smith@example.com", "anna@example.com"}, expected: exactMatch},
+		"fuzzy element":       {spec: "text", a: emails, b: "anna.smith@example.com", expected: fuzzyMatch},
+		"nested":              {a: []interface{}{[]interface{}{"a"}}, b: "a", expected: exactMatch},
+		"different structure": {a: []interface{}{"a"}, b: map[string]interface{}{"a": "a"}, expected: noMatch},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, compare(c.spec, c.a, c.b))
+			assert.Equal(t, c.expected, compare(c.spec, c.b, c.a), "comparison must be symmetric")
+		})
+	}
+
+	conditions := map[string]struct {
+		operators map[string]interface{}
+		value     interface{}
+		expected  match
+	}{
+		"any element":           {operators: map[string]interface{}{"$gte": 18.0}, value: []interface{}{12.0, 18.0}, expected: exactMatch},
+		"no element":            {operators: map[string]interface{}{"$gte": 18.0}, value: []interface{}{12.0, 17.0}, expected: noMatch},
+		"same element":          {operators: map[string]interface{}{"$gt": 5.0, "$lt": 3.0}, value: []interface{}{6.0, 1.0}, expected: noMatch},
+		"equal element":         {operators: map[string]interface{}{"$eq": "x"}, value: []interface{}{"x", "y"}, expected: exactMatch},
+		"equal slice":           {operators: map[string]interface{}{"$eq": []interface{}{"a", "b"}}, value: []interface{}{"a", "b"}, expected: exactMatch},
+		"different slice":       {operators: map[string]interface{}{"$eq": []interface{}{"a", "b"}}, value: []interface{}{"a", "c"}, expected: noMatch},
+		"not equal element":     {operators: map[string]interface{}{"$ne": "x"}, value: []interface{}{"x", "y"}, expected: noMatch},
+		"not equal any element": {operators: map[string]interface{}{"$ne": "x"}, value: []interface{}{"y", "z"}, expected: exactMatch},
+		"not equal slice":       {operators: map[string]interface{}{"$ne": []interface{}{"a", "b"}}, value: []interface{}{"a", "b"}, expected: noMatch},
+		"not equal other slice": {operators: map[string]interface{}{"$ne": []interface{}{"a", "b"}}, value: []interface{}{"a"}, expected: exactMatch},
+		"not equal and prefix":  {operators: map[string]interface{}{"$ne": "Jo", "$prefix": "Jo"}, value: []interface{}{"Jo", "John"}, expected: noMatch},
+		"not equal nested":      {operators: map[string]interface{}{"$ne": "x"}, value: []interface{}{[]interface{}{"x"}}, expected: noMatch},
+		"not equal empty slice": {operators: map[string]interface{}{"$ne": "x"}, value: []interface{}{}, expected: exactMatch},
+		"not equal missing":     {operators: map[string]interface{}{"$ne": "x"}, value: nil, expected: noMatch},
+	}
+	for name, c := range conditions {
+		t.Run(name, func(t *testing.T) {
+			condition, err := parseCondition("field", c.operators)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, c.expected, compare("", condition, c.value))
+		})
+	}
+}
+
+func TestMultipleValues(t *testing.T) {
+	ctx := context.Background()
+	records := []*api.Record{
+		{ID: "A", Data: map[string]interface{}{"email": []interface{}{"anna@example.com", "a.smith@example.com"}}},
+		{ID: "B", Data: map[string]interface{}{"email": "a.smith@example.com"}},
+		{ID: "C", Data: map[string]interface{}{"email": []interface{}{"bob@example.com"}}},
+	}
+
+	fixture := &FakeDispatcher{Rules: []Rule{{ID: "R1", Fields: []string{"email"}}}}
+	_, err := fixture.Submit(ctx, createSubmitInput(records...))
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+	if assert.Len(t, entities, 2) {
+		assert.Equal(t, []string{"A", "B"}, ids(entities[0].Records))
+	}
+	output, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"email": []interface{}{"anna@example.com", "carl@example.com"},
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Entities, 1) {
+		assert.Equal(t, []string{"A", "B"}, ids(output.Entities[0].Records))
+	}
+
+	fixture = &FakeDispatcher{}
+	_, err = fixture.Submit(ctx, createSubmitInput(records...))
+	assert.NoError(t, err)
+	output, err = fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"email": "a.smith@example.com",
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Entities, 1) {
+		assert.Equal(t, []string{"A", "B"}, ids(output.Entities[0].Records))
+	}
+}
@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config configures the plugin binary
+//
+// All file paths are optional, the corresponding feature is disabled if a
+// path is empty.
+type Config struct {
+	// Capacity defines the maximum number of stored records per dispatcher
+	Capacity int `yaml:"capacity"`
+
+	// Rules defines when records belong to the same entity
+	Rules []Rule `yaml:"rules"`
+
+	// MaxSearchResults defines the maximum number of entities per search
+	// result, unlimited if 0
+	MaxSearchResults int `yaml:"maxSearchResults"`
+
+	// SearchMode is either SearchModeRules (default) or SearchModeAny
+	SearchMode string `yaml:"searchMode"`
+
+	// Tenants is the path of a tenants file, if set, Capacity, Rules and
+	// MaxSearchResults MUST NOT be set, since they are configured per tenant
+	Tenants string `yaml:"tenants"`
+
+	// StrictMeta rejects Disassemble and RemoveConnectionBan calls without
+	// reference, user or reason
+	StrictMeta bool `yaml:"strictMeta"`
+
+	// Faults defines the injected latency and errors per method name, e.g.
+	// "Submit"
+	Faults map[string]Fault `yaml:"faults"`
+
+	Persistence PersistenceConfig `yaml:"persistence"`
+	Webhook     WebhookConfig     `yaml:"webhook"`
+	Logging     LoggingConfig     `yaml:"logging"`
+}
+
+// PersistenceConfig defines the files that are read at startup or written
+// while serving
+type PersistenceConfig struct {
+	// Fixtures is the path of a JSON lines file with records that are
+	// submitted at startup
+	Fixtures string `yaml:"fixtures"`
+
+	// Record is the path of the file to which all calls are appended
+	Record string `yaml:"record"`
+
+	// AuditLog is the path of the file to which all audit entries are appended
+	AuditLog string `yaml:"auditLog"`
+
+	// EventLog is the path of the file to which all events are appended
+	EventLog string `yaml:"eventLog"`
+}
+
+// WebhookConfig defines where events are delivered to
+type WebhookConfig struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+// LoggingConfig defines the log level and format, defaults to info and json
+type LoggingConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// ParseConfig parses and validates the config from YAML (or JSON) data
+//
+// Unknown keys are rejected to detect typos early.
+//
+// Example:
+//
+//	capacity: 1000
+//	rules:
+//	  - id: R1
+//	    fields: [email]
+//	searchMode: any
+//	faults:
+//	  Submit:
+//	    errorRate: 0.1
+//	    latency: 200ms
+//	persistence:
+//	  fixtures: fixtures.jsonl
+//	  auditLog: audit.jsonl
+//	logging:
+//	  level: debug
+//	  format: logfmt
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadConfig reads, parses and validates the config from the given file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// Validate returns an error if any setting is invalid
+func (c *Config) Validate() error {
+	if c.Capacity < 0 {
+		return fmt.Errorf("invalid capacity %v, must not be negative", c.Capacity)
+	}
+	if c.MaxSearchResults < 0 {
+		return fmt.Errorf("invalid maxSearchResults %v, must not be negative", c.MaxSearchResults)
+	}
+	err := ValidateRules(c.Rules)
+	if err != nil {
+		return fmt.Errorf("invalid rules: %w", err)
+	}
+	if c.Tenants != "" && (c.Capacity != 0 || len(c.Rules) != 0 || c.MaxSearchResults != 0) {
+		return fmt.Errorf("capacity, rules and maxSearchResults must be configured per tenant if tenants are set")
+	}
+	switch c.SearchMode {
+	case "", SearchModeAny:
+	case SearchModeRules:
+		if len(c.Rules) == 0 && c.Tenants == "" {
+			return fmt.Errorf("search mode %v requires rules", c.SearchMode)
+		}
+	default:
+		return fmt.Errorf("invalid search mode %v, must be either %v or %v", c.SearchMode, SearchModeRules, SearchModeAny)
+	}
+	err = ValidateFaults(c.Faults)
+	if err != nil {
+		return fmt.Errorf("invalid faults: %w", err)
+	}
+	if c.Webhook.Secret != "" && c.Webhook.URL == "" {
+		return fmt.Errorf("webhook secret requires a webhook url")
+	}
+	_, err = c.Logging.level()
+	if err != nil {
+		return err
+	}
+	if format := c.Logging.format(); format != LogFormatJSON && format != LogFormatLogfmt {
+		return fmt.Errorf("invalid log format %v, must be one of %v or %v", format, LogFormatJSON, LogFormatLogfmt)
+	}
+	return nil
+}
+
+// NewLogger returns a Logger for w using the configured level and format
+func (c *LoggingConfig) NewLogger(w io.Writer) (*Logger, error) {
+	level, err := c.level()
+	if err != nil {
+		return nil, err
+	}
+	return NewLogger(w, level, c.format())
+}
+
+func (c *LoggingConfig) level() (Level, error) {
+	if c.Level == "" {
+		return LevelInfo, nil
+	}
+	return ParseLevel(c.Level)
+}
+
+func (c *LoggingConfig) format() string {
+	if c.Format == "" {
+		return LogFormatJSON
+	}
+	return c.Format
+}
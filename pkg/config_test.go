@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+capacity: 1000
+rules:
+  - id: R1
+    fields: [email]
+searchMode: any
+strictMeta: true
+faults:
+  Submit:
+    errorRate: 0.5
+    latency: 200ms
+persistence:
+  fixtures: fixtures.jsonl
+  auditLog: audit.jsonl
+webhook:
+  url: http://localhost:8080/events
+logging:
+  level: debug
+  format: logfmt
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &Config{
+		Capacity:   1000,
+		Rules:      []Rule{{ID: "R1", Fields: []string{"email"}}},
+		SearchMode: SearchModeAny,
+		StrictMeta: true,
+		Faults:     map[string]Fault{"Submit": {ErrorRate: 0.5, Latency: 200 * time.Millisecond}},
+		Persistence: PersistenceConfig{
+			Fixtures: "fixtures.jsonl",
+			AuditLog: "audit.jsonl",
+		},
+		Webhook: WebhookConfig{URL: "http://localhost:8080/events"},
+		Logging: LoggingConfig{Level: "debug", Format: "logfmt"},
+	}, config)
+
+	config, err = ParseConfig([]byte(`{"capacity":5}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, config.Capacity)
+
+	config, err = ParseConfig([]byte{})
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{}, config)
+}
+
+func TestParseInvalidConfig(t *testing.T) {
+	cases := map[string]struct {
+		data     string
+		expected string
+	}{
+		"unknown key": {
+			data:     "capacty: 5",
+			expected: "invalid config: yaml: unmarshal errors:\n  line 1: field capacty not found in type pkg.Config",
+		},
+		"negative capacity": {
+			data:     "capacity: -1",
+			expected: "invalid capacity -1, must not be negative",
+		},
+		"negative max search results": {
+			data:     "maxSearchResults: -1",
+			expected: "invalid maxSearchResults -1, must not be negative",
+		},
+		"invalid rules": {
+			data:     "rules: [{id: R1}]",
+			expected: "invalid rules: rule R1 has no fields",
+		},
+		"invalid search mode": {
+			data:     "searchMode: all",
+			expected: "invalid search mode all, must be either rules or any",
+		},
+		"rules search mode without rules": {
+			data:     "searchMode: rules",
+			expected: "search mode rules requires rules",
+		},
+		"capacity with tenants": {
+			data:     "capacity: 5\ntenants: tenants.yaml",
+			expected: "capacity, rules and maxSearchResults must be configured per tenant if tenants are set",
+		},
+		"rules with tenants": {
+			data:     "rules: [{id: R1, fields: [email]}]\ntenants: tenants.yaml",
+			expected: "capacity, rules and maxSearchResults must be configured per tenant if tenants are set",
+		},
+		"fault of unknown method": {
+			data:     "faults: {Delete: {errorRate: 0.5}}",
+			expected: "invalid faults: unknown method Delete, must be one of Entity, Submit, Search, Disassemble or RemoveConnectionBan",
+		},
+		"invalid fault error rate": {
+			data:     "faults: {Search: {errorRate: 1.5}}",
+			expected: "invalid faults: invalid error rate 1.5 of method Search, must be between 0 and 1",
+		},
+		"negative fault latency": {
+			data:     "faults: {Entity: {latency: -1s}}",
+			expected: "invalid faults: invalid latency -1s of method Entity, must not be negative",
+		},
+		"webhook secret without url": {
+			data:     "webhook: {secret: s3cr3t}",
+			expected: "webhook secret requires a webhook url",
+		},
+		"invalid log level": {
+			data:     "logging: {level: verbose}",
+			expected: "invalid log level verbose, must be one of debug, info, warn, error, off",
+		},
+		"invalid log format": {
+			data:     "logging: {format: xml}",
+			expected: "invalid log format xml, must be one of json or logfmt",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(c.data))
+			assert.EqualError(t, err, c.expected)
+		})
+	}
+}
+
+func TestLoggingConfigNewLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	config := &LoggingConfig{Level: "warn", Format: "logfmt"}
+	logger, err := config.NewLogger(buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, logger.Enabled(LevelInfo))
+	assert.True(t, logger.Enabled(LevelWarn))
+	assert.True(t, logger.logfmt)
+}
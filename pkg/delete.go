@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+)
+
+// DeleteRecordsInput includes the data required to delete records
+//
+// A record is deleted if its ID is listed in RecordIDs or if it matches Where.
+type DeleteRecordsInput struct {
+	RecordIDs []string `json:"recordIDs"`
+
+	// Where selects all records that match all of the given fields in the
+	// same way as search parameters, including operators and multi-valued
+	// fields
+	Where map[string]interface{} `json:"where"`
+}
+
+// DeleteRecordsOutput contains the IDs of the deleted records and the IDs of
+// the entities that remained of the affected entities
+type DeleteRecordsOutput struct {
+	DeletedRecords int      `json:"deletedRecords"`
+	DeletedEdges   int      `json:"deletedEdges"`
+	RecordIDs      []string `json:"recordIDs"`
+	EntityIDs      []string `json:"entityIDs"`
+}
+
+// DeleteRecords hard deletes records, e.g. for testing GDPR requests
+//
+// In contrast to Disassemble, the records are also removed from the history
+// and from connection bans, so that no data of the records is kept. Affected
+// entities are split if necessary. Record IDs that do not exist are ignored.
+func (f *FakeDispatcher) DeleteRecords(_ context.Context, input *DeleteRecordsInput) (*DeleteRecordsOutput, error) {
+	if len(input.RecordIDs) == 0 && len(input.Where) == 0 {
+		return nil, fmt.Errorf("no record IDs or predicate provided for delete")
+	}
+	where, err := parseWhere(input.Where)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.currentTime()
+	recordIDs := f.selectRecords(input.RecordIDs, where)
+	output := &DeleteRecordsOutput{
+		DeletedRecords: len(recordIDs),
+		RecordIDs:      recordIDs,
+		EntityIDs:      []string{},
+	}
+	events := make([]Event, 0, len(recordIDs))
+	if f.clustering() {
+		store := f.entityStore()
+		affectedRecordIDs := []string{}
+		for _, entityID := range store.entityIDsOf(recordIDs) {
+			affectedRecordIDs = append(affectedRecordIDs, store.entities[entityID]...)
+		}
+		for _, recordID := range recordIDs {
+			events = append(events, Event{Type: EventRecordDeleted, RecordID: recordID, EntityID: store.entityIDs[recordID]})
+			output.DeletedEdges += store.remove(recordID)
+			store.forget(recordID)
+			f.removeRecord(recordID)
+		}
+		events = append(events, f.rebuild(now)...)
+		output.EntityIDs = store.entityIDsOf(affectedRecordIDs)
+	} else {
+		for _, recordID := range recordIDs {
+			events = append(events, Event{Type: EventRecordDeleted, RecordID: recordID})
+			f.removeRecord(recordID)
+		}
+	}
+	for _, recordID := range recordIDs {
+		f.recordHistory().forget(recordID)
+	}
+
+	f.emit(now, events...)
+	return output, nil
+}
+
+// selectRecords returns the unique IDs of all stored records that are listed
+// or match all conditions of where, ordered from oldest to newest
+func (f *FakeDispatcher) selectRecords(listedIDs []string, where map[string]interface{}) []string {
+	listed := make(map[string]bool, len(listedIDs))
+	for _, recordID := range listedIDs {
+		listed[recordID] = true
+	}
+	selected := map[string]bool{}
+	recordIDs := []string{}
+	for _, record := range f.oldestFirst() {
+		if selected[record.ID] {
+			continue
+		}
+		if listed[record.ID] || len(where) != 0 && matchesAll(record.Data, where) {
+			selected[record.ID] = true
+			recordIDs = append(recordIDs, record.ID)
+		}
+	}
+	return recordIDs
+}
+
+// parseWhere returns the fields of the predicate, where values with operators
+// are replaced by their conditions
+func parseWhere(where map[string]interface{}) (map[string]interface{}, error) {
+	parsed := make(map[string]interface{}, len(where))
+	for field, value := range where {
+		var err error
+		parsed[field], err = parseCondition(field, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid predicate: %w", err)
+		}
+	}
+	return parsed, nil
+}
+
+// matchesAll returns true if the data matches all fields like a search
+// parameter without comparator would
+func matchesAll(data map[string]interface{}, fields map[string]interface{}) bool {
+	for field, value := range fields {
+		if compare("", value, data[field]) == noMatch {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestDeleteRecords(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "smith@example.com"),
+		person("C", "John", "Doe", "anna@example.com"),
+		person("D", "Jane", "Roe", "jane@example.com"),
+	))
+	assert.NoError(t, err)
+	entityID := fixture.Entities()[0].ID
+
+	output, err := fixture.DeleteRecords(ctx, &DeleteRecordsInput{RecordIDs: []string{"A", "unknown"}})
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+	if !assert.Len(t, entities, 3) {
+		return
+	}
+	assert.Equal(t, &DeleteRecordsOutput{
+		DeletedRecords: 1,
+		DeletedEdges:   2,
+		RecordIDs:      []string{"A"},
+		EntityIDs:      []string{entityID, entities[1].ID},
+	}, output)
+	assert.Equal(t, []string{"B"}, ids(entities[0].Records))
+	assert.Equal(t, []string{"C"}, ids(entities[1].Records))
+	assert.Equal(t, []string{"D"}, ids(entities[2].Records))
+
+	history, err := fixture.RecordHistory(ctx, &RecordHistoryInput{ID: "A"})
+	assert.NoError(t, err)
+	assert.Empty(t, history.Versions)
+	assert.Empty(t, history.Memberships)
+
+	events, err := fixture.Events(ctx, &EventsInput{After: 6})
+	assert.NoError(t, err)
+	if assert.Len(t, events.Events, 2) {
+		assert.Equal(t, EventRecordDeleted, events.Events[0].Type)
+		assert.Equal(t, "A", events.Events[0].RecordID)
+		assert.Equal(t, entityID, events.Events[0].EntityID)
+		assert.Equal(t, EventEntitySplit, events.Events[1].Type)
+	}
+}
+
+func TestDeleteRecordsWhere(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "John", "Doe", "john@example.com"),
+		person("C", "Ann", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+
+	output, err := fixture.DeleteRecords(ctx, &DeleteRecordsInput{
+		Where: map[string]interface{}{"email": "anna@example.com"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A", "C"}, output.RecordIDs)
+	assert.Equal(t, 1, output.DeletedEdges)
+	assert.Empty(t, output.EntityIDs)
+	assert.Equal(t, []string{"B"}, ids(fixture.Records()))
+}
+
+func TestDeleteRecordsWhereLikeSearch(t *testing.T) {
+	fixture := &FakeDispatcher{}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		&api.Record{ID: "A", Data: map[string]interface{}{"tags": []interface{}{"x", "y"}, "age": 17}},
+		&api.Record{ID: "B", Data: map[string]interface{}{"tags": []interface{}{"y"}, "age": 30}},
+		&api.Record{ID: "C", Data: map[string]interface{}{"tags": []interface{}{"z"}, "age": 40}},
+	))
+	assert.NoError(t, err)
+
+	where := map[string]interface{}{
+		"tags": "y",
+		"age":  map[string]interface{}{OperatorGreaterEqual: 18},
+	}
+	search, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: (*api.SearchParameters)(&where)})
+	assert.NoError(t, err)
+	output, err := fixture.DeleteRecords(ctx, &DeleteRecordsInput{Where: where})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"B"}, output.RecordIDs)
+	if assert.Len(t, search.Entities, 1) {
+		assert.Contains(t, ids(search.Entities[0].Records), "B", "search must find the deleted record")
+	}
+	assert.Equal(t, []string{"A", "C"}, ids(fixture.Records()))
+
+	_, err = fixture.DeleteRecords(ctx, &DeleteRecordsInput{
+		Where: map[string]interface{}{"age": map[string]interface{}{"$unknown": 1}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"A", "C"}, ids(fixture.Records()))
+}
+
+func TestDeleteRecordsWithoutRules(t *testing.T) {
+	fixture := &FakeDispatcher{}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "John", "Doe", "john@example.com"),
+		person("A", "Ann", "Smith", "ann@example.com"),
+	))
+	assert.NoError(t, err)
+
+	output, err := fixture.DeleteRecords(ctx, &DeleteRecordsInput{
+		Where: map[string]interface{}{"firstName": "Ann"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &DeleteRecordsOutput{
+		DeletedRecords: 1,
+		RecordIDs:      []string{"A"},
+		EntityIDs:      []string{},
+	}, output)
+	assert.Equal(t, []string{"B"}, ids(fixture.Records()))
+
+	_, err = fixture.DeleteRecords(ctx, &DeleteRecordsInput{})
+	assert.EqualError(t, err, "no record IDs or predicate provided for delete")
+}
+
+func TestDeleteRecordsRemovesConnectionBans(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Edges:               []dispatcher.DisassembleEdge{{A: "A", B: "B"}},
+		CreateConnectionBan: true,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, fixture.store.bans, 1)
+
+	_, err = fixture.DeleteRecords(ctx, &DeleteRecordsInput{RecordIDs: []string{"A"}})
+	assert.NoError(t, err)
+	assert.Empty(t, fixture.store.bans)
+}
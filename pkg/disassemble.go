@@ -0,0 +1,231 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// Disassemble removes the given edges and records
+//
+// Without rules, there are no edges and only records can be removed. With
+// rules, the output contains the IDs of the entities that remain from the
+// affected entities. If requested, connection bans are created between all of
+// these entities. Since a connection ban only applies to the records of the
+// banned entities, new records may still connect them again.
+//
+// Disassemble fails without any modification if neither edges nor records are
+// provided, if an edge or record does not exist or if the metadata is missing
+// in strict meta mode.
+//
+// Repeating a successful call with the same reference returns the original
+// output without any further modification. Reusing a reference with different
+// parameters fails.
+func (f *FakeDispatcher) Disassemble(_ context.Context, input *dispatcher.DisassembleInput) (_ *dispatcher.DisassembleOutput, err error) {
+	defer f.observe(methodDisassemble, time.Now(), &err)
+	if len(input.Edges) == 0 && len(input.RecordIDs) == 0 {
+		return nil, fmt.Errorf("no edges or records provided for disassemble")
+	}
+	if err := f.validateMeta(input.Reference, input.Meta.User, input.Meta.Reason); err != nil {
+		return nil, err
+	}
+	call, err := referencedCall(methodDisassemble, input)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous, err := f.previousCall(input.Reference, call)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		return copyDisassembleOutput(previous.output), nil
+	}
+
+	now := f.currentTime()
+	var output *dispatcher.DisassembleOutput
+	var entityIDs []string
+	var events []Event
+	if f.clustering() {
+		entityIDs, output, events, err = f.disassembleEntities(now, input)
+	} else {
+		output, err = f.disassembleRecords(now, input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.rememberCall(input.Reference, call, output)
+	f.writeAudit(AuditEntry{
+		Time:                now,
+		Action:              AuditActionDisassemble,
+		Reference:           input.Reference,
+		User:                input.Meta.User,
+		Reason:              input.Meta.Reason,
+		Edges:               append([]dispatcher.DisassembleEdge(nil), input.Edges...),
+		RecordIDs:           append([]string(nil), input.RecordIDs...),
+		CreateConnectionBan: input.CreateConnectionBan,
+		DeletedEdges:        output.DeletedEdges,
+		DeletedRecords:      output.DeletedRecords,
+		EntityIDs:           entityIDs,
+		ResultEntityIDs:     append([]string(nil), output.EntityIDs...),
+	})
+	f.emit(now, events...)
+	return output, nil
+}
+
+// disassembleRecords removes records when no rules exist
+func (f *FakeDispatcher) disassembleRecords(now time.Time, input *dispatcher.DisassembleInput) (*dispatcher.DisassembleOutput, error) {
+	if len(input.Edges) != 0 {
+		return nil, fmt.Errorf("edge %v:%v does not exist", input.Edges[0].A, input.Edges[0].B)
+	}
+	stored := make(map[string]bool, f.length)
+	for _, record := range f.records[0:f.length] {
+		stored[record.ID] = true
+	}
+	for _, recordID := range input.RecordIDs {
+		if !stored[recordID] {
+			return nil, fmt.Errorf("record %v does not exist", recordID)
+		}
+	}
+
+	output := &dispatcher.DisassembleOutput{
+		EntityIDs: []string{},
+	}
+	for _, recordID := range input.RecordIDs {
+		for _, removed := range f.removeRecord(recordID) {
+			f.recordHistory().removed(now, removed)
+			output.DeletedRecords++
+		}
+	}
+	return output, nil
+}
+
+// disassembleEntities removes edges and records when rules exist and returns
+// the IDs of the affected entities before the disassembly as well as the
+// resulting events
+func (f *FakeDispatcher) disassembleEntities(now time.Time, input *dispatcher.DisassembleInput) ([]string, *dispatcher.DisassembleOutput, []Event, error) {
+	store := f.entityStore()
+	for _, edge := range input.Edges {
+		if len(store.links[edge.A][edge.B]) == 0 {
+			return nil, nil, nil, fmt.Errorf("edge %v:%v does not exist", edge.A, edge.B)
+		}
+	}
+	for _, recordID := range input.RecordIDs {
+		if _, ok := store.records[recordID]; !ok {
+			return nil, nil, nil, fmt.Errorf("record %v does not exist", recordID)
+		}
+	}
+
+	affectedRecordIDs := make([]string, 0, len(input.Edges)*2+len(input.RecordIDs))
+	for _, edge := range input.Edges {
+		affectedRecordIDs = append(affectedRecordIDs, edge.A, edge.B)
+	}
+	affectedRecordIDs = append(affectedRecordIDs, input.RecordIDs...)
+	entityIDs := []string{}
+	recordIDs := []string{}
+	for _, entityID := range store.entityIDsOf(affectedRecordIDs) {
+		entityIDs = append(entityIDs, entityID)
+		recordIDs = append(recordIDs, store.entities[entityID]...)
+	}
+
+	history := f.recordHistory()
+	output := &dispatcher.DisassembleOutput{}
+	for _, edge := range input.Edges {
+		output.DeletedEdges += int32(store.unlink(edge.A, edge.B))
+	}
+	for _, recordID := range input.RecordIDs {
+		if _, ok := store.records[recordID]; !ok {
+			continue // listed more than once
+		}
+		output.DeletedEdges += int32(store.remove(recordID))
+		output.DeletedRecords++
+		for _, removed := range f.removeRecord(recordID) {
+			history.removed(now, removed)
+		}
+	}
+	events := f.rebuild(now)
+
+	output.EntityIDs = store.entityIDsOf(recordIDs)
+	if input.CreateConnectionBan && store.ban(output.EntityIDs) != 0 {
+		events = append(events, Event{Type: EventConnectionBanCreated, EntityIDs: append([]string(nil), output.EntityIDs...)})
+	}
+	return entityIDs, output, events, nil
+}
+
+// RemoveConnectionBan removes the connection bans between the entity and all
+// other entities
+//
+// Records that were prevented from connecting by the removed connection bans
+// are linked again, if they match any rule.
+//
+// RemoveConnectionBan fails without any modification if no connection ban
+// exists between the entity and any of the others or if the metadata is
+// missing in strict meta mode.
+//
+// Repeating a successful call with the same reference does nothing. Reusing a
+// reference with different parameters fails.
+func (f *FakeDispatcher) RemoveConnectionBan(_ context.Context, input *dispatcher.RemoveConnectionBanInput) (err error) {
+	defer f.observe(methodRemoveConnectionBan, time.Now(), &err)
+	if len(input.Others) == 0 {
+		return fmt.Errorf("no other entity provided for removing the connection ban")
+	}
+	if err := f.validateMeta(input.Reference, input.Meta.User, input.Meta.Reason); err != nil {
+		return err
+	}
+	call, err := referencedCall(methodRemoveConnectionBan, input)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous, err := f.previousCall(input.Reference, call)
+	if err != nil || previous != nil {
+		return err
+	}
+	if !f.clustering() {
+		return fmt.Errorf("no connection ban exists between %v and %v", input.EntityID, input.Others[0])
+	}
+
+	now := f.currentTime()
+	store := f.entityStore()
+	recordIDs, err := store.removeBans(input.EntityID, input.Others)
+	if err != nil {
+		return err
+	}
+	events := []Event{{Type: EventConnectionBanRemoved, EntityID: input.EntityID, EntityIDs: append([]string(nil), input.Others...)}}
+	events = append(events, f.rebuild(now)...)
+
+	f.rememberCall(input.Reference, call, nil)
+	f.writeAudit(AuditEntry{
+		Time:            now,
+		Action:          AuditActionRemoveConnectionBan,
+		Reference:       input.Reference,
+		User:            input.Meta.User,
+		Reason:          input.Meta.Reason,
+		EntityIDs:       append([]string{input.EntityID}, input.Others...),
+		ResultEntityIDs: store.entityIDsOf(recordIDs),
+	})
+	f.emit(now, events...)
+	return nil
+}
+
+// validateMeta returns an error in strict meta mode if the reference, the user
+// or the reason is empty
+func (f *FakeDispatcher) validateMeta(reference, user, reason string) error {
+	if !f.StrictMeta {
+		return nil
+	}
+	if reference == "" {
+		return fmt.Errorf("reference must not be empty")
+	}
+	if user == "" {
+		return fmt.Errorf("meta user must not be empty")
+	}
+	if reason == "" {
+		return fmt.Errorf("meta reason must not be empty")
+	}
+	return nil
+}
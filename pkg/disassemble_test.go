@@ -0,0 +1,185 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestDisassembleEdgeWithConnectionBan(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+		person("C", "Ann", "Smith", "c@example.com"),
+	))
+	assert.NoError(t, err)
+	entityID := fixture.Entities()[0].ID
+
+	output, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Edges:               []dispatcher.DisassembleEdge{{A: "B", B: "C"}},
+		CreateConnectionBan: true,
+	})
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+	if !assert.Len(t, entities, 2) {
+		return
+	}
+	assert.Equal(t, int32(1), output.DeletedEdges)
+	assert.Equal(t, int32(0), output.DeletedRecords)
+	assert.Equal(t, []string{entityID, entities[1].ID}, output.EntityIDs)
+	assert.Equal(t, []string{"A", "B"}, ids(entities[0].Records))
+	assert.Equal(t, []string{"C"}, ids(entities[1].Records))
+
+	_, err = fixture.Submit(ctx, createSubmitInput(person("C", "Ann", "Smith", "c@example.com")))
+	assert.NoError(t, err)
+	assert.Len(t, fixture.Entities(), 2, "resubmitted records must stay banned")
+
+	err = fixture.RemoveConnectionBan(ctx, &dispatcher.RemoveConnectionBanInput{
+		EntityID: entities[1].ID,
+		Others:   []string{entityID},
+	})
+	assert.NoError(t, err)
+	entities = fixture.Entities()
+	if !assert.Len(t, entities, 1) {
+		return
+	}
+	assert.Equal(t, entityID, entities[0].ID)
+	assert.ElementsMatch(t, []string{"A:B:R2", "B:C:R1"}, entities[0].Edges)
+
+	err = fixture.RemoveConnectionBan(ctx, &dispatcher.RemoveConnectionBanInput{
+		EntityID: entityID,
+		Others:   []string{"unknown"},
+	})
+	assert.EqualError(t, err, "no connection ban exists between "+entityID+" and unknown")
+}
+
+func TestDisassembleEdgeWithoutConnectionBan(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+
+	output, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Edges: []dispatcher.DisassembleEdge{{A: "A", B: "B"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), output.DeletedEdges)
+	assert.Len(t, output.EntityIDs, 2)
+
+	_, err = fixture.Submit(ctx, createSubmitInput(person("B", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err)
+	assert.Len(t, fixture.Entities(), 1, "resubmitted records must be linked again")
+}
+
+func TestDisassembleRecords(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+		person("C", "Ann", "Smith", "c@example.com"),
+	))
+	assert.NoError(t, err)
+
+	output, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		RecordIDs: []string{"B", "B"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), output.DeletedEdges)
+	assert.Equal(t, int32(1), output.DeletedRecords)
+	assert.Len(t, output.EntityIDs, 2)
+	assert.Equal(t, []string{"A", "C"}, ids(fixture.Records()))
+}
+
+func TestDisassembleFailsWithoutModification(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		input       *dispatcher.DisassembleInput
+		expectedErr string
+	}{
+		"empty": {
+			input:       &dispatcher.DisassembleInput{},
+			expectedErr: "no edges or records provided for disassemble",
+		},
+		"unknown edge": {
+			input: &dispatcher.DisassembleInput{
+				Edges:     []dispatcher.DisassembleEdge{{A: "A", B: "C"}},
+				RecordIDs: []string{"B"},
+			},
+			expectedErr: "edge A:C does not exist",
+		},
+		"unknown record": {
+			input: &dispatcher.DisassembleInput{
+				Edges:     []dispatcher.DisassembleEdge{{A: "A", B: "B"}},
+				RecordIDs: []string{"C"},
+			},
+			expectedErr: "record C does not exist",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := fixture.Disassemble(ctx, c.input)
+			assert.EqualError(t, err, c.expectedErr)
+			assert.Len(t, fixture.Records(), 2)
+			assert.Len(t, fixture.Entities(), 1)
+		})
+	}
+}
+
+func TestStrictMeta(t *testing.T) {
+	fixture := &FakeDispatcher{StrictMeta: true}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(record("1"), record("2")))
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		reference   string
+		user        string
+		reason      string
+		expectedErr string
+	}{
+		"missing reference": {user: "jane", reason: "wrong data", expectedErr: "reference must not be empty"},
+		"missing user":      {reference: "ref", reason: "wrong data", expectedErr: "meta user must not be empty"},
+		"missing reason":    {reference: "ref", user: "jane", expectedErr: "meta reason must not be empty"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+				Reference: c.reference,
+				RecordIDs: []string{"1"},
+				Meta:      dispatcher.DisassembleMeta{User: c.user, Reason: c.reason},
+			})
+			assert.EqualError(t, err, c.expectedErr)
+			err = fixture.RemoveConnectionBan(ctx, &dispatcher.RemoveConnectionBanInput{
+				Reference: c.reference,
+				EntityID:  "some-id",
+				Others:    []string{"other-id"},
+				Meta:      dispatcher.RemoveConnectionBanMeta{User: c.user, Reason: c.reason},
+			})
+			assert.EqualError(t, err, c.expectedErr)
+			assert.Len(t, fixture.Records(), 2)
+		})
+	}
+
+	output, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Reference: "ref",
+		RecordIDs: []string{"1"},
+		Meta:      dispatcher.DisassembleMeta{User: "jane", Reason: "wrong data"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), output.DeletedRecords)
+}
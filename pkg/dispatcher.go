@@ -3,6 +3,9 @@ package pkg
 import (
 	"context"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	api "github.com/tilotech/tilores-plugin-api"
@@ -10,40 +13,148 @@ import (
 )
 
 // FakeDispatcher Dispatcher implements Dispatcher interface which Fakes TiloRes functionality as a showcase
+//
+// Without rules, all records belong to a single entity. With rules, records are
+// grouped into entities based on matching rules, similar to the real TiloRes.
+//
+// FakeDispatcher is safe for concurrent use.
 type FakeDispatcher struct {
-	records [10]*api.Record
+	// Capacity defines the maximum number of stored records, defaults to 10
+	//
+	// Capacity MUST NOT be changed after the first record was submitted.
+	Capacity int
+
+	// Rules defines when records belong to the same entity
+	//
+	// Rules MUST NOT be changed after the first record was submitted, use
+	// Reload instead.
+	Rules []Rule
+
+	// MaxSearchResults defines the maximum number of entities per search
+	// result, Search fails if more entities would be returned, unlimited if 0
+	MaxSearchResults int
+
+	// SearchMode defines how Search finds records, either SearchModeRules or
+	// SearchModeAny, defaults to SearchModeRules
+	//
+	// Without rules, Search always uses SearchModeAny.
+	SearchMode string
+
+	// AuditLog receives an audit entry as JSON line for every successful
+	// Disassemble and RemoveConnectionBan call, if set
+	AuditLog io.Writer
+
+	// EventLog receives every event as JSON line, if set
+	EventLog io.Writer
+
+	// HistoryCapacity defines the number of record versions that are kept in
+	// the history after the records were overridden, updated or disassembled,
+	// defaults to Capacity
+	//
+	// HistoryCapacity MUST NOT be changed after the first record was
+	// submitted.
+	HistoryCapacity int
+
+	// EventCapacity defines the number of kept events, defaults to 1000
+	EventCapacity int
+
+	// StrictMeta rejects Disassemble and RemoveConnectionBan calls without
+	// reference, user or reason, as required for calls triggered by a person
+	StrictMeta bool
+
+	// OnError is called with errors that occur after a call already modified
+	// the dispatcher, e.g. failing audit or event log writes, if set
+	//
+	// OnError is called while the dispatcher is locked and MUST NOT call the
+	// dispatcher.
+	OnError func(err error)
+
+	mu      sync.Mutex
+	records []*api.Record
 	index   int
 	length  int
+	store   *entityStore
+	history *history
+	audit   []AuditEntry
+	now     func() time.Time
+
+	references map[string]*processedCall
+
+	events      []Event
+	lastEvent   int64
+	eventSignal chan struct{}
+
+	metrics metrics
 }
 
+// DefaultCapacity is the number of stored records if no capacity was configured
+const DefaultCapacity = 10
+
+// search modes of the FakeDispatcher
+const (
+	// SearchModeRules finds records for which all fields of any rule match
+	SearchModeRules = "rules"
+
+	// SearchModeAny finds records for which any search parameter matches
+	SearchModeAny = "any"
+)
+
 // Entity get the Entity with the provided entity ID
-func (f *FakeDispatcher) Entity(_ context.Context, input *dispatcher.EntityInput) (*dispatcher.EntityOutput, error) {
+//
+// Without rules, the entity always contains all records. With rules, the entity
+// is nil if no entity with the provided ID exists.
+func (f *FakeDispatcher) Entity(_ context.Context, input *dispatcher.EntityInput) (_ *dispatcher.EntityOutput, err error) {
+	defer f.observe(methodEntity, time.Now(), &err)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.clustering() {
+		return &dispatcher.EntityOutput{
+			Entity: f.entityStore().entity(input.ID),
+		}, nil
+	}
 	return &dispatcher.EntityOutput{
-		Entity: &api.Entity{
-			ID:         input.ID,
-			Records:    f.records[0:f.length],
-			Edges:      api.Edges{},
-			Duplicates: api.Duplicates{},
-			Hits:       api.Hits{},
-		},
+		Entity: allRecordsEntity(input.ID, f.copyRecords()),
 	}, nil
 }
 
-// Disassemble not implemented for fake dispatcher
-func (f *FakeDispatcher) Disassemble(_ context.Context, _ *dispatcher.DisassembleInput) (*dispatcher.DisassembleOutput, error) {
-	return nil, fmt.Errorf("not implemented for fake dispatcher")
-}
-
-// RemoveConnectionBan not implemented for fake dispatcher
-func (f *FakeDispatcher) RemoveConnectionBan(_ context.Context, _ *dispatcher.RemoveConnectionBanInput) error {
-	return fmt.Errorf("not implemented for fake dispatcher")
-}
-
 // Submit adds new records to in-memory storage
-func (f *FakeDispatcher) Submit(_ context.Context, input *dispatcher.SubmitInput) (*dispatcher.SubmitOutput, error) {
-	for _, record := range input.Records {
-		f.addRecord(record)
+func (f *FakeDispatcher) Submit(_ context.Context, input *dispatcher.SubmitInput) (_ *dispatcher.SubmitOutput, err error) {
+	defer f.observe(methodSubmit, time.Now(), &err)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.currentTime()
+	history := f.recordHistory()
+	events := make([]Event, 0, len(input.Records))
+	if f.clustering() {
+		store := f.entityStore()
+		for _, record := range input.Records {
+			if _, ok := store.records[record.ID]; ok {
+				for _, removed := range f.removeRecord(record.ID) {
+					history.removed(now, removed)
+				}
+			}
+			if evicted := f.addRecord(record); evicted != nil {
+				store.remove(evicted.ID)
+				history.removed(now, evicted)
+			}
+			store.add(record)
+			history.added(now, record)
+		}
+		entityEvents := f.rebuild(now)
+		for _, record := range input.Records {
+			events = append(events, Event{Type: EventRecordAdded, RecordID: record.ID, EntityID: store.entityIDs[record.ID]})
+		}
+		events = append(events, entityEvents...)
+	} else {
+		for _, record := range input.Records {
+			if evicted := f.addRecord(record); evicted != nil {
+				history.removed(now, evicted)
+			}
+			history.added(now, record)
+			events = append(events, Event{Type: EventRecordAdded, RecordID: record.ID})
+		}
 	}
+	f.emit(now, events...)
 	return &dispatcher.SubmitOutput{
 		RecordsAdded: len(input.Records),
 	}, nil
@@ -51,44 +162,214 @@ func (f *FakeDispatcher) Submit(_ context.Context, input *dispatcher.SubmitInput
 
 // Search finds all matching records and returns a slice of Entity
 //
-// The fake search will return maximum one entity which includes all matching records, unlike the real search.
+// Without rules, the fake search will return maximum one entity which includes all matching records, unlike the real search.
 // Not all search parameters need to match a record field to consider the record a match, one is enough.
-func (f *FakeDispatcher) Search(_ context.Context, input *dispatcher.SearchInput) (*dispatcher.SearchOutput, error) {
+//
+// With rules, all entities are returned that have at least one record for
+// which all fields of a rule match the search parameters, ordered by their
+// score. The score of an entity is the score of its best matching record, which
+// is the sum of the weights of its matching rules, where fuzzy matches count
+// half. With the reserved search parameter SearchScoreKey, the score is
+// included in the hits using the same key.
+//
+// With rules and SearchModeAny, all entities are returned that have at least
+// one record for which any search parameter matches. The hits contain the
+// matched search parameters and the score is their number.
+//
+// The reserved search parameters SearchOffsetKey and SearchLimitKey select
+// which of the found entities are returned. Search fails if more than
+// MaxSearchResults entities would be returned.
+func (f *FakeDispatcher) Search(_ context.Context, input *dispatcher.SearchInput) (_ *dispatcher.SearchOutput, err error) {
+	defer f.observe(methodSearch, time.Now(), &err)
+	options, parameters, err := parseSearchOptions(input.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var entities []*api.Entity
+	switch {
+	case !f.clustering():
+		entities = f.searchRecords(parameters)
+	case f.SearchMode == SearchModeAny:
+		entities = f.entityStore().searchAny(parameters, options.score)
+	default:
+		entities = f.entityStore().search(parameters, options.score)
+	}
+	entities = options.page(entities)
+	if f.MaxSearchResults > 0 && len(entities) > f.MaxSearchResults {
+		return nil, fmt.Errorf("search found more than %v entities, use %v to limit the results", f.MaxSearchResults, SearchLimitKey)
+	}
+	return &dispatcher.SearchOutput{
+		Entities: entities,
+	}, nil
+}
+
+// searchRecords returns at most one entity with all records that match any of
+// the search parameters
+func (f *FakeDispatcher) searchRecords(parameters api.SearchParameters) []*api.Entity {
 	matchingRecords := make([]*api.Record, 0, f.length)
 	for i := 0; i < f.length; i++ {
 		record := f.records[i]
-		for key, value := range *input.Parameters {
-			if record.Data[key] == value {
+		for key, value := range parameters {
+			if compare("", value, record.Data[key]) != noMatch {
 				matchingRecords = append(matchingRecords, record)
 				break
 			}
 		}
 	}
 	if len(matchingRecords) == 0 {
-		return &dispatcher.SearchOutput{
-			Entities: []*api.Entity{},
-		}, nil
+		return []*api.Entity{}
 	}
-	return &dispatcher.SearchOutput{
-		Entities: []*api.Entity{
-			{
-				ID:         uuid.New().String(),
-				Records:    matchingRecords,
-				Edges:      api.Edges{},
-				Duplicates: api.Duplicates{},
-				Hits:       api.Hits{},
-			},
+	return []*api.Entity{
+		{
+			ID:         uuid.New().String(),
+			Records:    matchingRecords,
+			Edges:      api.Edges{},
+			Duplicates: api.Duplicates{},
+			Hits:       api.Hits{},
 		},
-	}, nil
+	}
+}
+
+// Records returns a copy of all currently stored records
+//
+// The records are returned in storage order, where new records override the
+// oldest ones.
+func (f *FakeDispatcher) Records() []*api.Record {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.copyRecords()
+}
+
+func (f *FakeDispatcher) copyRecords() []*api.Record {
+	records := make([]*api.Record, f.length)
+	copy(records, f.records[0:f.length])
+	return records
+}
+
+// Entities returns all entities
+//
+// Without rules, a single entity without ID is returned that contains all
+// records. With rules, the entities are ordered by their oldest record.
+func (f *FakeDispatcher) Entities() []*api.Entity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.clustering() {
+		return []*api.Entity{allRecordsEntity("", f.copyRecords())}
+	}
+	return f.entityStore().allEntities()
+}
+
+// allRecordsEntity returns the entity that is used when no rules exist
+func allRecordsEntity(entityID string, records []*api.Record) *api.Entity {
+	return &api.Entity{
+		ID:         entityID,
+		Records:    records,
+		Edges:      api.Edges{},
+		Duplicates: api.Duplicates{},
+		Hits:       api.Hits{},
+	}
 }
 
-func (f *FakeDispatcher) addRecord(record *api.Record) {
+func (f *FakeDispatcher) clustering() bool {
+	return len(f.Rules) != 0
+}
+
+func (f *FakeDispatcher) entityStore() *entityStore {
+	if f.store == nil {
+		f.store = newEntityStore(f.Rules)
+	}
+	return f.store
+}
+
+// rebuild updates the entities and the membership history after records or
+// links were modified and returns the resulting entity events
+//
+// Only the affected entities and their records are updated, so that the cost
+// does not depend on the number of stored records.
+func (f *FakeDispatcher) rebuild(now time.Time) []Event {
+	store := f.entityStore()
+	previous, rebuilt := store.rebuild()
+	recordIDs := []string{}
+	for _, entityRecordIDs := range previous {
+		recordIDs = append(recordIDs, entityRecordIDs...)
+	}
+	for _, entityID := range rebuilt {
+		recordIDs = append(recordIDs, store.entities[entityID]...)
+	}
+	f.recordHistory().updateMemberships(now, store.entityIDs, recordIDs)
+	return entityEvents(previous, rebuilt, store)
+}
+
+// addRecord stores the record and returns the evicted record if the capacity
+// was exceeded
+func (f *FakeDispatcher) addRecord(record *api.Record) *api.Record {
+	if f.records == nil {
+		f.records = make([]*api.Record, f.capacity())
+	}
+	evicted := f.records[f.index]
 	f.records[f.index] = record
 	f.index++
-	if f.index == 10 {
+	if f.index == len(f.records) {
 		f.index = 0
 	}
-	if f.length < 10 {
+	if f.length < len(f.records) {
 		f.length++
 	}
+	return evicted
+}
+
+// removeRecord removes and returns all records with the given ID
+//
+// The remaining records are moved to the beginning of the storage, starting
+// with the oldest record.
+func (f *FakeDispatcher) removeRecord(recordID string) []*api.Record {
+	removed := []*api.Record{}
+	remaining := make([]*api.Record, 0, f.length)
+	for _, record := range f.oldestFirst() {
+		if record.ID != recordID {
+			remaining = append(remaining, record)
+		} else {
+			removed = append(removed, record)
+		}
+	}
+	f.replaceRecords(remaining)
+	return removed
+}
+
+// oldestFirst returns all stored records ordered from oldest to newest
+func (f *FakeDispatcher) oldestFirst() []*api.Record {
+	records := make([]*api.Record, 0, f.length)
+	for i := 0; i < f.length; i++ {
+		// the oldest record is at the index position, once the storage is full
+		record := f.records[(f.index+i)%f.length]
+		if f.length < len(f.records) {
+			record = f.records[i]
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// replaceRecords replaces the storage with the given records, which are
+// ordered from oldest to newest
+func (f *FakeDispatcher) replaceRecords(records []*api.Record) {
+	f.records = make([]*api.Record, len(f.records))
+	f.length = copy(f.records, records)
+	f.index = f.length % len(f.records)
+}
+
+func (f *FakeDispatcher) capacity() int {
+	if f.Capacity <= 0 {
+		return DefaultCapacity
+	}
+	return f.Capacity
+}
+
+// reportError passes the error to OnError, if set
+func (f *FakeDispatcher) reportError(err error) {
+	if f.OnError != nil {
+		f.OnError(err)
+	}
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	api "github.com/tilotech/tilores-plugin-api"
 	"github.com/tilotech/tilores-plugin-api/dispatcher"
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg/dispatchertest"
 )
 
 func TestFakeDispatcher(t *testing.T) {
@@ -63,6 +64,8 @@ func TestFakeDispatcher(t *testing.T) {
 
 	_, err = fixture.Submit(ctx, createSubmitInput(record("11")))
 	assert.NoError(t, err)
+	actual, err = fixture.Entity(ctx, &dispatcher.EntityInput{ID: "foo-id"})
+	assert.NoError(t, err)
 	assert.Equal(t, 10, len(actual.Entity.Records))
 	assert.Equal(t, "11", actual.Entity.Records[0].ID)
 	assert.Equal(t, "2", actual.Entity.Records[1].ID)
@@ -73,6 +76,71 @@ func TestFakeDispatcher(t *testing.T) {
 	assert.NotNil(t, actual.Entity.Hits)
 }
 
+func TestFakeDispatcherCapacity(t *testing.T) {
+	fixture := &FakeDispatcher{Capacity: 3}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(record("1"), record("2"), record("3"), record("4")))
+	assert.NoError(t, err)
+	actual := fixture.Records()
+	assert.Equal(t, 3, len(actual))
+	assert.Equal(t, "4", actual[0].ID)
+	assert.Equal(t, "2", actual[1].ID)
+	assert.Equal(t, "3", actual[2].ID)
+}
+
+func TestFakeDispatcherContract(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		dispatchertest.Run(t, dispatchertest.Config{}, func() dispatcher.Dispatcher {
+			return &FakeDispatcher{}
+		})
+	})
+	t.Run("capacity", func(t *testing.T) {
+		dispatchertest.Run(t, dispatchertest.Config{Capacity: 25}, func() dispatcher.Dispatcher {
+			return &FakeDispatcher{Capacity: 25}
+		})
+	})
+	t.Run("rules", func(t *testing.T) {
+		dispatchertest.Run(t, dispatchertest.Config{Capacity: 5, Clustering: true}, func() dispatcher.Dispatcher {
+			return &FakeDispatcher{Capacity: 5, Rules: contractRules}
+		})
+	})
+}
+
+func TestFakeDispatcherPluginContract(t *testing.T) {
+	var p *InProcessPlugin
+	defer func() {
+		if p != nil {
+			assert.NoError(t, p.Close())
+		}
+	}()
+	run := func(t *testing.T, config dispatchertest.Config, newFake func() *FakeDispatcher) {
+		dispatchertest.Run(t, config, func() dispatcher.Dispatcher {
+			if p != nil {
+				assert.NoError(t, p.Close())
+			}
+			var err error
+			p, err = StartInProcess(newFake())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p.Dispatcher
+		})
+	}
+	t.Run("default", func(t *testing.T) {
+		run(t, dispatchertest.Config{}, func() *FakeDispatcher { return nil })
+	})
+	t.Run("rules", func(t *testing.T) {
+		run(t, dispatchertest.Config{Clustering: true}, func() *FakeDispatcher {
+			return &FakeDispatcher{Rules: contractRules}
+		})
+	})
+}
+
+// contractRules is the single rule on dispatchertest.MatchField expected by
+// the contract tests with clustering
+var contractRules = []Rule{{ID: "R1", Fields: []string{dispatchertest.MatchField}}}
+
 func record(id string) *api.Record {
 	idInt, _ := strconv.Atoi(id)
 	return &api.Record{
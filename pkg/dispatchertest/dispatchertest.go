@@ -0,0 +1,252 @@
+// Package dispatchertest provides a reusable contract test suite for
+// implementations of the dispatcher interface.
+//
+// The suite verifies the documented behaviour of the fake dispatcher, with and
+// without rules. It can be used to check that other dispatchers, e.g. wrappers
+// around the fake or a plugin connected via dispatcher.Connect, behave the same
+// way.
+package dispatchertest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// DefaultCapacity is the capacity that is expected if Config.Capacity is 0,
+// which is the default capacity of the fake dispatcher
+const DefaultCapacity = 10
+
+// MatchField is the record field that the matching rule of a clustering
+// dispatcher MUST use, see Config.Clustering
+const MatchField = "name"
+
+// Config describes the expected behaviour of the tested dispatcher
+type Config struct {
+	// Capacity is the maximum number of records the dispatcher keeps, defaults
+	// to DefaultCapacity
+	Capacity int
+
+	// Clustering is set if the dispatcher groups records into entities using
+	// a single rule with the field MatchField, as the fake dispatcher does
+	// with rules
+	//
+	// Without clustering, all records belong to a single entity, which is
+	// returned for any entity ID.
+	Clustering bool
+}
+
+func (c Config) capacity() int {
+	if c.Capacity == 0 {
+		return DefaultCapacity
+	}
+	return c.Capacity
+}
+
+// Run runs all contract tests as sub tests of t.
+//
+// newDispatcher is invoked once per sub test and MUST return a dispatcher
+// without any submitted records that behaves as described by config.
+func Run(t *testing.T, config Config, newDispatcher func() dispatcher.Dispatcher) {
+	t.Run("Entity", func(t *testing.T) { testEntity(t, config, newDispatcher()) })
+	t.Run("Submit", func(t *testing.T) { testSubmit(t, config, newDispatcher()) })
+	t.Run("Search", func(t *testing.T) { testSearch(t, config, newDispatcher()) })
+	t.Run("Disassemble", func(t *testing.T) { testDisassemble(t, config, newDispatcher()) })
+	t.Run("RemoveConnectionBan", func(t *testing.T) { testRemoveConnectionBan(t, newDispatcher()) })
+}
+
+func testEntity(t *testing.T, config Config, d dispatcher.Dispatcher) {
+	ctx := context.Background()
+
+	output, err := d.Entity(ctx, &dispatcher.EntityInput{ID: "empty-id"})
+	require.NoError(t, err)
+	if config.Clustering {
+		assert.Nil(t, output.Entity, "unknown entities must be nil")
+	} else {
+		require.NotNil(t, output.Entity)
+		assert.Equal(t, "empty-id", output.Entity.ID)
+		assert.Empty(t, output.Entity.Records)
+	}
+
+	submit(t, d, record("1"), record("2"))
+	if config.Clustering {
+		found := entityOf(t, d, "1")
+		require.NotNil(t, found, "record 1 must be found")
+		output, err = d.Entity(ctx, &dispatcher.EntityInput{ID: found.ID})
+		require.NoError(t, err)
+		require.NotNil(t, output.Entity)
+		assert.Equal(t, found.ID, output.Entity.ID)
+		assert.ElementsMatch(t, []string{"1"}, recordIDs(output.Entity))
+	} else {
+		output, err = d.Entity(ctx, &dispatcher.EntityInput{ID: "some-id"})
+		require.NoError(t, err)
+		require.NotNil(t, output.Entity)
+		assert.Equal(t, "some-id", output.Entity.ID)
+		assert.ElementsMatch(t, []string{"1", "2"}, recordIDs(output.Entity))
+	}
+	assert.NotNil(t, output.Entity.Edges)
+	assert.NotNil(t, output.Entity.Duplicates)
+	assert.NotNil(t, output.Entity.Hits)
+}
+
+func testSubmit(t *testing.T, config Config, d dispatcher.Dispatcher) {
+	ctx := context.Background()
+	capacity := config.capacity()
+
+	output, err := d.Submit(ctx, &dispatcher.SubmitInput{Records: []*api.Record{record("1"), record("2")}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, output.RecordsAdded)
+
+	records := make([]*api.Record, 0, capacity)
+	for i := 3; i <= capacity+1; i++ {
+		records = append(records, record(strconv.Itoa(i)))
+	}
+	output, err = d.Submit(ctx, &dispatcher.SubmitInput{Records: records})
+	require.NoError(t, err)
+	assert.Equal(t, len(records), output.RecordsAdded)
+
+	if config.Clustering {
+		assert.Nil(t, entityOf(t, d, "1"), "oldest record must be overridden")
+		assert.NotNil(t, entityOf(t, d, "2"))
+		assert.NotNil(t, entityOf(t, d, strconv.Itoa(capacity+1)))
+		return
+	}
+	entity, err := d.Entity(ctx, &dispatcher.EntityInput{ID: "some-id"})
+	require.NoError(t, err)
+	require.NotNil(t, entity.Entity)
+	ids := recordIDs(entity.Entity)
+	assert.Len(t, ids, capacity)
+	assert.NotContains(t, ids, "1", "oldest record must be overridden")
+	assert.Contains(t, ids, "2")
+	assert.Contains(t, ids, strconv.Itoa(capacity+1))
+}
+
+func testSearch(t *testing.T, config Config, d dispatcher.Dispatcher) {
+	ctx := context.Background()
+
+	output, err := d.Search(ctx, search(MatchField, "record-1"))
+	require.NoError(t, err)
+	assert.NotNil(t, output.Entities)
+	assert.Empty(t, output.Entities)
+
+	submit(t, d, record("1"), record("2"), record("3"))
+
+	if config.Clustering {
+		output, err = d.Search(ctx, search(MatchField, "record-3"))
+		require.NoError(t, err)
+		require.Len(t, output.Entities, 1)
+		assert.NotEmpty(t, output.Entities[0].ID)
+		assert.ElementsMatch(t, []string{"3"}, recordIDs(output.Entities[0]))
+
+		output, err = d.Search(ctx, search("isOdd", true))
+		require.NoError(t, err)
+		assert.Empty(t, output.Entities, "parameters without rule must not match")
+	} else {
+		output, err = d.Search(ctx, search("isOdd", true))
+		require.NoError(t, err)
+		require.Len(t, output.Entities, 1)
+		assert.NotEmpty(t, output.Entities[0].ID)
+		assert.ElementsMatch(t, []string{"1", "3"}, recordIDs(output.Entities[0]))
+
+		output, err = d.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+			"isOdd":    false,
+			MatchField: "record-3",
+		}})
+		require.NoError(t, err)
+		require.Len(t, output.Entities, 1)
+		assert.ElementsMatch(t, []string{"2", "3"}, recordIDs(output.Entities[0]), "one matching parameter must be enough")
+	}
+
+	output, err = d.Search(ctx, search(MatchField, "unknown"))
+	require.NoError(t, err)
+	assert.Empty(t, output.Entities)
+}
+
+func testDisassemble(t *testing.T, config Config, d dispatcher.Dispatcher) {
+	ctx := context.Background()
+	submit(t, d, record("1"), record("2"))
+
+	output, err := d.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Reference: "ref",
+		RecordIDs: []string{"1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), output.DeletedRecords)
+	assert.Equal(t, int32(0), output.DeletedEdges)
+
+	if config.Clustering {
+		assert.Nil(t, entityOf(t, d, "1"), "disassembled record must be deleted")
+		assert.NotNil(t, entityOf(t, d, "2"))
+	} else {
+		entity, err := d.Entity(ctx, &dispatcher.EntityInput{ID: "some-id"})
+		require.NoError(t, err)
+		require.NotNil(t, entity.Entity)
+		assert.ElementsMatch(t, []string{"2"}, recordIDs(entity.Entity))
+	}
+
+	_, err = d.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Reference: "another-ref",
+		RecordIDs: []string{"1"},
+	})
+	assert.Error(t, err, "disassembling an unknown record must fail")
+}
+
+func testRemoveConnectionBan(t *testing.T, d dispatcher.Dispatcher) {
+	err := d.RemoveConnectionBan(context.Background(), &dispatcher.RemoveConnectionBanInput{
+		Reference: "ref",
+		EntityID:  "some-id",
+		Others:    []string{"other-id"},
+	})
+	assert.Error(t, err, "removing a connection ban that does not exist must fail")
+}
+
+// record returns the record with the given numeric id as used by the suite
+//
+// The record data contains a unique name and whether the id is odd.
+func record(id string) *api.Record {
+	idInt, _ := strconv.Atoi(id)
+	return &api.Record{
+		ID: id,
+		Data: map[string]interface{}{
+			MatchField: "record-" + id,
+			"isOdd":    idInt%2 == 1,
+		},
+	}
+}
+
+// entityOf returns the entity that contains the record with the given id
+// using a search for its name, or nil if the record does not exist
+func entityOf(t *testing.T, d dispatcher.Dispatcher, id string) *api.Entity {
+	output, err := d.Search(context.Background(), search(MatchField, "record-"+id))
+	require.NoError(t, err)
+	for _, entity := range output.Entities {
+		for _, r := range entity.Records {
+			if r.ID == id {
+				return entity
+			}
+		}
+	}
+	return nil
+}
+
+func submit(t *testing.T, d dispatcher.Dispatcher, records ...*api.Record) {
+	_, err := d.Submit(context.Background(), &dispatcher.SubmitInput{Records: records})
+	require.NoError(t, err)
+}
+
+func search(key string, value interface{}) *dispatcher.SearchInput {
+	return &dispatcher.SearchInput{Parameters: &api.SearchParameters{key: value}}
+}
+
+func recordIDs(entity *api.Entity) []string {
+	ids := make([]string, 0, len(entity.Records))
+	for _, r := range entity.Records {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
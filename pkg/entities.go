@@ -0,0 +1,660 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/google/uuid"
+	api "github.com/tilotech/tilores-plugin-api"
+)
+
+// entityStore groups records into entities based on matching rules
+//
+// Two records belong to the same entity if they are connected by a chain of
+// rule matches. After modifying records or links, rebuild MUST be called to
+// update the entities of the touched records.
+type entityStore struct {
+	rules   []Rule
+	records map[string]*api.Record
+	seq     map[string]int
+	nextSeq int
+
+	// links contains the matching rule ids for each pair of records in both
+	// directions
+	links map[string]map[string][]string
+
+	// blocks contains the record ids per blocking key for each rule, only
+	// records within the same block are compared using that rule
+	blocks       []map[string]map[string]bool
+	blockingKeys []blockingKey
+
+	entityIDs       map[string]string   // record id -> entity id
+	entities        map[string][]string // entity id -> record ids in insertion order
+	createdEntities int
+
+	// touched contains the ids of all records that were added or removed or
+	// whose links changed since the last rebuild
+	touched map[string]bool
+
+	bans []*connectionBan
+}
+
+// connectionBan prevents links between the records of two former entities
+type connectionBan struct {
+	a map[string]bool
+	b map[string]bool
+}
+
+// entityNamespace is used to derive deterministic entity ids
+var entityNamespace = uuid.MustParse("b3cbb2f4-0a3d-4c36-9a5e-2f1d06bc14a0")
+
+func newEntityStore(rules []Rule) *entityStore {
+	s := &entityStore{
+		rules:     rules,
+		records:   map[string]*api.Record{},
+		seq:       map[string]int{},
+		links:     map[string]map[string][]string{},
+		entityIDs: map[string]string{},
+		entities:  map[string][]string{},
+		touched:   map[string]bool{},
+	}
+	s.resetBlocks()
+	return s
+}
+
+// resetBlocks parses the blocking keys of the current rules and removes all
+// records from their blocks
+func (s *entityStore) resetBlocks() {
+	s.blocks = make([]map[string]map[string]bool, len(s.rules))
+	s.blockingKeys = make([]blockingKey, len(s.rules))
+	for i := range s.rules {
+		s.blocks[i] = map[string]map[string]bool{}
+		s.blockingKeys[i] = newBlockingKey(s.rules[i].Blocking)
+	}
+}
+
+func (s *entityStore) add(record *api.Record) {
+	s.remove(record.ID)
+	s.touched[record.ID] = true
+	s.connect(record)
+	s.records[record.ID] = record
+	s.seq[record.ID] = s.nextSeq
+	s.nextSeq++
+}
+
+// connect links the record with all records in its blocks that match any rule
+// and are not banned, then adds the record to its blocks
+func (s *entityStore) connect(record *api.Record) {
+	for id, ruleIDs := range s.candidateMatches(record) {
+		if !s.banned(record.ID, id) {
+			s.link(record.ID, id, ruleIDs)
+		}
+	}
+	s.block(record)
+}
+
+// candidateMatches returns the matching rule ids for each record that shares
+// a block with the given record
+func (s *entityStore) candidateMatches(record *api.Record) map[string][]string {
+	matches := map[string][]string{}
+	for i := range s.rules {
+		rule := &s.rules[i]
+		keys := s.blockingKeys[i].keys(record.Data)
+		// records with multiple values can share multiple blocks with others
+		compared := map[string]bool{}
+		for _, key := range keys {
+			for id := range s.blocks[i][key] {
+				if id == record.ID || compared[id] {
+					continue
+				}
+				if len(keys) > 1 {
+					compared[id] = true
+				}
+				if rule.matches(record.Data, s.records[id].Data) {
+					matches[id] = append(matches[id], rule.ID)
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// block adds the record to its blocks of all rules
+func (s *entityStore) block(record *api.Record) {
+	for i := range s.rules {
+		for _, key := range s.blockingKeys[i].keys(record.Data) {
+			if s.blocks[i][key] == nil {
+				s.blocks[i][key] = map[string]bool{}
+			}
+			s.blocks[i][key][record.ID] = true
+		}
+	}
+}
+
+// unblock removes the record from its blocks of all rules
+func (s *entityStore) unblock(record *api.Record) {
+	for i := range s.rules {
+		for _, key := range s.blockingKeys[i].keys(record.Data) {
+			delete(s.blocks[i][key], record.ID)
+			if len(s.blocks[i][key]) == 0 {
+				delete(s.blocks[i], key)
+			}
+		}
+	}
+}
+
+// remove removes the record and returns the number of removed edges
+func (s *entityStore) remove(recordID string) int {
+	record, ok := s.records[recordID]
+	if !ok {
+		return 0
+	}
+	s.unblock(record)
+	s.touched[recordID] = true
+	edges := 0
+	for other, ruleIDs := range s.links[recordID] {
+		edges += len(ruleIDs)
+		delete(s.links[other], recordID)
+	}
+	delete(s.links, recordID)
+	delete(s.records, recordID)
+	delete(s.seq, recordID)
+	return edges
+}
+
+// forget removes the record from all connection bans, bans without records on
+// either side are removed
+func (s *entityStore) forget(recordID string) {
+	remaining := s.bans[:0]
+	for _, ban := range s.bans {
+		delete(ban.a, recordID)
+		delete(ban.b, recordID)
+		if len(ban.a) != 0 && len(ban.b) != 0 {
+			remaining = append(remaining, ban)
+		}
+	}
+	s.bans = remaining
+}
+
+// unlink removes all edges between a and b and returns the number of removed
+// edges
+func (s *entityStore) unlink(a, b string) int {
+	edges := len(s.links[a][b])
+	s.touched[a] = true
+	s.touched[b] = true
+	delete(s.links[a], b)
+	delete(s.links[b], a)
+	return edges
+}
+
+// banned returns true if a connection ban exists between the records a and b
+func (s *entityStore) banned(a, b string) bool {
+	for _, ban := range s.bans {
+		if ban.a[a] && ban.b[b] || ban.a[b] && ban.b[a] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingRules returns the ids of all rules that match both records and for
+// which both records share a block
+func (s *entityStore) matchingRules(a, b *api.Record) []string {
+	ruleIDs := []string{}
+	for i := range s.rules {
+		if s.blockingKeys[i].shared(a.Data, b.Data) && s.rules[i].matches(a.Data, b.Data) {
+			ruleIDs = append(ruleIDs, s.rules[i].ID)
+		}
+	}
+	return ruleIDs
+}
+
+func (s *entityStore) link(a, b string, ruleIDs []string) {
+	if s.links[a] == nil {
+		s.links[a] = map[string][]string{}
+	}
+	if s.links[b] == nil {
+		s.links[b] = map[string][]string{}
+	}
+	s.links[a][b] = ruleIDs
+	s.links[b][a] = ruleIDs
+	s.touched[a] = true
+	s.touched[b] = true
+}
+
+// recluster replaces the rules and recalculates the links between all records,
+// connection bans are kept
+func (s *entityStore) recluster(rules []Rule) {
+	s.rules = rules
+	s.links = map[string]map[string][]string{}
+	s.resetBlocks()
+	for _, recordID := range s.recordIDs() {
+		s.touched[recordID] = true
+		s.connect(s.records[recordID])
+	}
+}
+
+// setRules replaces the rules without recalculating the links, the new rules
+// only apply to records added later
+func (s *entityStore) setRules(rules []Rule) {
+	s.rules = rules
+	s.resetBlocks()
+	for _, record := range s.records {
+		s.block(record)
+	}
+}
+
+// rebuild recalculates the entities of all touched records from the current
+// links and returns the replaced entities and the ids of the rebuilt entities,
+// ordered by their oldest record
+//
+// Only the entities that contained a touched record or that are now connected
+// to one are rebuilt, all other entities are unaffected by the changes.
+//
+// Entities keep their id if they still contain records of the previous entity
+// with that id. If multiple new entities share records with the same previous
+// entity, the one with the largest overlap keeps the id, preferring the entity
+// with the oldest record on ties. Likewise, if a new entity contains records of
+// multiple previous entities, it prefers the id of the largest overlap and then
+// of the previous entity with the oldest record. All other entities get a new
+// id.
+func (s *entityStore) rebuild() (map[string][]string, []string) {
+	previous := map[string][]string{}
+	start := make([]string, 0, len(s.touched))
+	for recordID := range s.touched {
+		if entityID, ok := s.entityIDs[recordID]; ok && previous[entityID] == nil {
+			previous[entityID] = s.entities[entityID]
+			start = append(start, s.entities[entityID]...)
+		}
+		start = append(start, recordID)
+	}
+	s.touched = map[string]bool{}
+	components := s.components(start)
+
+	type claim struct {
+		component int
+		entityID  string
+		overlap   int
+		oldest    int
+	}
+	claims := []claim{}
+	for i, component := range components {
+		componentClaims := map[string]*claim{}
+		for _, recordID := range component {
+			entityID, ok := s.entityIDs[recordID]
+			if !ok {
+				continue
+			}
+			// touched records may have been linked to untouched entities
+			if previous[entityID] == nil {
+				previous[entityID] = s.entities[entityID]
+			}
+			if c, ok := componentClaims[entityID]; ok {
+				c.overlap++
+				continue
+			}
+			// components are sorted, therefore the first record is the oldest
+			componentClaims[entityID] = &claim{component: i, entityID: entityID, overlap: 1, oldest: s.seq[recordID]}
+		}
+		for _, c := range componentClaims {
+			claims = append(claims, *c)
+		}
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		if claims[i].overlap != claims[j].overlap {
+			return claims[i].overlap > claims[j].overlap
+		}
+		if claims[i].component != claims[j].component {
+			return claims[i].component < claims[j].component
+		}
+		return claims[i].oldest < claims[j].oldest
+	})
+
+	ids := make([]string, len(components))
+	taken := map[string]bool{}
+	for _, c := range claims {
+		if ids[c.component] == "" && !taken[c.entityID] {
+			ids[c.component] = c.entityID
+			taken[c.entityID] = true
+		}
+	}
+
+	for entityID, recordIDs := range previous {
+		delete(s.entities, entityID)
+		for _, recordID := range recordIDs {
+			delete(s.entityIDs, recordID)
+		}
+	}
+	for i, component := range components {
+		if ids[i] == "" {
+			ids[i] = s.newEntityID()
+		}
+		s.entities[ids[i]] = component
+		for _, recordID := range component {
+			s.entityIDs[recordID] = ids[i]
+		}
+	}
+	return previous, ids
+}
+
+// components returns the connected record ids of all given records that still
+// exist, each in insertion order
+//
+// The components are sorted by their oldest record.
+func (s *entityStore) components(recordIDs []string) [][]string {
+	visited := make(map[string]bool, len(recordIDs))
+	components := [][]string{}
+	for _, start := range recordIDs {
+		if _, ok := s.records[start]; !ok || visited[start] {
+			continue
+		}
+		visited[start] = true
+		component := []string{start}
+		for i := 0; i < len(component); i++ {
+			for other := range s.links[component[i]] {
+				if !visited[other] {
+					visited[other] = true
+					component = append(component, other)
+				}
+			}
+		}
+		s.sortBySeq(component)
+		components = append(components, component)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return s.seq[components[i][0]] < s.seq[components[j][0]]
+	})
+	return components
+}
+
+// recordIDs returns all record ids in insertion order
+func (s *entityStore) recordIDs() []string {
+	recordIDs := make([]string, 0, len(s.records))
+	for id := range s.records {
+		recordIDs = append(recordIDs, id)
+	}
+	s.sortBySeq(recordIDs)
+	return recordIDs
+}
+
+func (s *entityStore) sortBySeq(recordIDs []string) {
+	sort.Slice(recordIDs, func(i, j int) bool {
+		return s.seq[recordIDs[i]] < s.seq[recordIDs[j]]
+	})
+}
+
+// newEntityID returns a new entity id that has never been used before
+//
+// The ids are deterministic, i.e. the same sequence of operations always
+// results in the same entity ids.
+func (s *entityStore) newEntityID() string {
+	s.createdEntities++
+	return uuid.NewSHA1(entityNamespace, []byte(strconv.Itoa(s.createdEntities))).String()
+}
+
+// entity returns the entity with the given id or nil if it does not exist
+func (s *entityStore) entity(entityID string) *api.Entity {
+	recordIDs, ok := s.entities[entityID]
+	if !ok {
+		return nil
+	}
+	records := make([]*api.Record, 0, len(recordIDs))
+	for _, recordID := range recordIDs {
+		records = append(records, s.records[recordID])
+	}
+	return buildEntity(entityID, records, func(a, b *api.Record) []string {
+		return s.links[a.ID][b.ID]
+	})
+}
+
+// buildEntity creates the entity for the given records, where ruleIDs returns
+// the matching rules for a pair of records
+//
+// Edges always point from the older to the newer record, the oldest record of
+// identical records is considered the original of its duplicates.
+func buildEntity(entityID string, records []*api.Record, ruleIDs func(a, b *api.Record) []string) *api.Entity {
+	entity := &api.Entity{
+		ID:         entityID,
+		Records:    records,
+		Edges:      api.Edges{},
+		Duplicates: api.Duplicates{},
+		Hits:       api.Hits{},
+	}
+	originals := map[string]string{}
+	for i, a := range records {
+		for _, b := range records[i+1:] {
+			for _, ruleID := range ruleIDs(a, b) {
+				entity.Edges = append(entity.Edges, fmt.Sprintf("%v:%v:%v", a.ID, b.ID, ruleID))
+			}
+		}
+		data, _ := json.Marshal(a.Data)
+		if original, ok := originals[string(data)]; ok {
+			entity.Duplicates[original] = append(entity.Duplicates[original], a.ID)
+		} else {
+			originals[string(data)] = a.ID
+		}
+	}
+	return entity
+}
+
+// allEntities returns all entities ordered by their oldest record
+func (s *entityStore) allEntities() []*api.Entity {
+	entityIDs := s.sortedEntityIDs()
+	entities := make([]*api.Entity, 0, len(entityIDs))
+	for _, entityID := range entityIDs {
+		entities = append(entities, s.entity(entityID))
+	}
+	return entities
+}
+
+// sortedEntityIDs returns all entity ids ordered by their oldest record
+func (s *entityStore) sortedEntityIDs() []string {
+	entityIDs := make([]string, 0, len(s.entities))
+	for entityID := range s.entities {
+		entityIDs = append(entityIDs, entityID)
+	}
+	sort.Slice(entityIDs, func(i, j int) bool {
+		return s.seq[s.entities[entityIDs[i]][0]] < s.seq[s.entities[entityIDs[j]][0]]
+	})
+	return entityIDs
+}
+
+// search returns all entities with at least one record that matches any rule
+// using the search parameters, ordered by their score and then by their oldest
+// matching record
+//
+// A rule matches if all of its fields are part of the search parameters and
+// equal or are similar to the records value. The matched rules are listed in
+// the entities hits, as well as the score if requested.
+func (s *entityStore) search(parameters api.SearchParameters, withScore bool) []*api.Entity {
+	return s.find(withScore, func(data map[string]interface{}) ([]string, float64) {
+		ruleIDs := []string{}
+		score := 0.0
+		for i := range s.rules {
+			m := s.rules[i].match(parameters, data)
+			if m != noMatch {
+				ruleIDs = append(ruleIDs, s.rules[i].ID)
+				score += s.rules[i].score(m)
+			}
+		}
+		return ruleIDs, score
+	})
+}
+
+// searchAny returns all entities with at least one record for which any search
+// parameter equals or is similar to the records value, ordered by their score
+// and then by their oldest matching record
+//
+// The matched search parameters are listed in the entities hits, the score is
+// the number of matched search parameters.
+func (s *entityStore) searchAny(parameters api.SearchParameters, withScore bool) []*api.Entity {
+	return s.find(withScore, func(data map[string]interface{}) ([]string, float64) {
+		keys := []string{}
+		for key, value := range parameters {
+			if compare("", value, data[key]) != noMatch {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		return keys, float64(len(keys))
+	})
+}
+
+// find returns all entities with at least one record for which match returns
+// the matched rules or parameters, ordered by the score of their best matching
+// record
+func (s *entityStore) find(withScore bool, match func(data map[string]interface{}) ([]string, float64)) []*api.Entity {
+	hits := map[string]api.Hits{}
+	scores := map[string]float64{}
+	entityIDs := []string{}
+	for _, recordID := range s.recordIDs() {
+		matched, score := match(s.records[recordID].Data)
+		if len(matched) == 0 {
+			continue
+		}
+		entityID := s.entityIDs[recordID]
+		if _, ok := hits[entityID]; !ok {
+			hits[entityID] = api.Hits{}
+			entityIDs = append(entityIDs, entityID)
+		}
+		hits[entityID][recordID] = matched
+		if score > scores[entityID] {
+			scores[entityID] = score
+		}
+	}
+	sort.SliceStable(entityIDs, func(i, j int) bool {
+		return scores[entityIDs[i]] > scores[entityIDs[j]]
+	})
+
+	entities := make([]*api.Entity, 0, len(entityIDs))
+	for _, entityID := range entityIDs {
+		entity := s.entity(entityID)
+		entity.Hits = hits[entityID]
+		if withScore {
+			entity.Hits[SearchScoreKey] = []string{formatFloat(scores[entityID])}
+		}
+		entities = append(entities, entity)
+	}
+	return entities
+}
+
+// entityIDsOf returns the entity ids of the given records, ordered by their
+// oldest record
+//
+// Records that no longer exist are ignored.
+func (s *entityStore) entityIDsOf(recordIDs []string) []string {
+	existing := make([]string, 0, len(recordIDs))
+	for _, recordID := range recordIDs {
+		if _, ok := s.records[recordID]; ok {
+			existing = append(existing, recordID)
+		}
+	}
+	s.sortBySeq(existing)
+	entityIDs := []string{}
+	seen := map[string]bool{}
+	for _, recordID := range existing {
+		entityID := s.entityIDs[recordID]
+		if !seen[entityID] {
+			seen[entityID] = true
+			entityIDs = append(entityIDs, entityID)
+		}
+	}
+	return entityIDs
+}
+
+// ban creates connection bans between the records of each pair of the given
+// entities and returns the number of created bans
+func (s *entityStore) ban(entityIDs []string) int {
+	created := 0
+	for i, a := range entityIDs {
+		for _, b := range entityIDs[i+1:] {
+			s.bans = append(s.bans, &connectionBan{
+				a: toSet(s.entities[a]),
+				b: toSet(s.entities[b]),
+			})
+			created++
+		}
+	}
+	return created
+}
+
+// removeBans removes all connection bans between the entity and the others,
+// links the previously banned records if they match and returns their ids
+//
+// After removing bans, rebuild MUST be called to update the entities.
+func (s *entityStore) removeBans(entityID string, others []string) ([]string, error) {
+	remove := map[*connectionBan]bool{}
+	for _, other := range others {
+		found := false
+		for _, ban := range s.bans {
+			if s.bansEntities(ban, entityID, other) {
+				remove[ban] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no connection ban exists between %v and %v", entityID, other)
+		}
+	}
+
+	remaining := make([]*connectionBan, 0, len(s.bans)-len(remove))
+	for _, ban := range s.bans {
+		if !remove[ban] {
+			remaining = append(remaining, ban)
+		}
+	}
+	s.bans = remaining
+
+	recordIDs := []string{}
+	for ban := range remove {
+		for a := range ban.a {
+			recordIDs = append(recordIDs, a)
+			for b := range ban.b {
+				s.relink(a, b)
+			}
+		}
+		for b := range ban.b {
+			recordIDs = append(recordIDs, b)
+		}
+	}
+	return recordIDs, nil
+}
+
+// bansEntities returns true if the ban applies to records of both entities
+func (s *entityStore) bansEntities(ban *connectionBan, entityID, other string) bool {
+	return s.belongsTo(ban.a, entityID) && s.belongsTo(ban.b, other) ||
+		s.belongsTo(ban.a, other) && s.belongsTo(ban.b, entityID)
+}
+
+// belongsTo returns true if any of the records belongs to the entity
+func (s *entityStore) belongsTo(recordIDs map[string]bool, entityID string) bool {
+	for recordID := range recordIDs {
+		if s.entityIDs[recordID] == entityID {
+			return true
+		}
+	}
+	return false
+}
+
+// relink links both records if they exist, are not banned and match any rule
+func (s *entityStore) relink(a, b string) {
+	recordA, okA := s.records[a]
+	recordB, okB := s.records[b]
+	if !okA || !okB || s.banned(a, b) {
+		return
+	}
+	ruleIDs := s.matchingRules(recordA, recordB)
+	if len(ruleIDs) != 0 {
+		s.link(a, b, ruleIDs)
+	}
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
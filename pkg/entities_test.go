@@ -0,0 +1,234 @@
+package pkg
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+var testRules = []Rule{
+	{ID: "R1", Fields: []string{"firstName", "lastName"}},
+	{ID: "R2", Fields: []string{"email"}},
+}
+
+func TestFakeDispatcherClustering(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+		person("C", "Anna", "Smith", "smith@example.com"),
+		person("D", "John", "Doe", "john@example.com"),
+		person("E", "John", "Doe", "john@example.com"),
+	))
+	assert.NoError(t, err)
+
+	entities := fixture.Entities()
+	if !assert.Len(t, entities, 2) {
+		return
+	}
+	assert.Equal(t, []string{"A", "B", "C"}, ids(entities[0].Records))
+	assert.Equal(t, api.Edges{"A:B:R2", "A:C:R1"}, entities[0].Edges)
+	assert.Empty(t, entities[0].Duplicates)
+	assert.Equal(t, []string{"D", "E"}, ids(entities[1].Records))
+	assert.Equal(t, api.Edges{"D:E:R1", "D:E:R2"}, entities[1].Edges)
+	assert.Equal(t, api.Duplicates{"D": {"E"}}, entities[1].Duplicates)
+
+	actual, err := fixture.Entity(ctx, &dispatcher.EntityInput{ID: entities[0].ID})
+	assert.NoError(t, err)
+	assert.Equal(t, entities[0], actual.Entity)
+
+	actual, err = fixture.Entity(ctx, &dispatcher.EntityInput{ID: "unknown"})
+	assert.NoError(t, err)
+	assert.Nil(t, actual.Entity)
+}
+
+func TestFakeDispatcherClusteringKeepsEntityIDs(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules, Capacity: 5}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+		person("C", "Anna", "Smith", "smith@example.com"),
+		person("D", "John", "Doe", "john@example.com"),
+	))
+	assert.NoError(t, err)
+	before := fixture.Entities()
+
+	// merge
+	_, err = fixture.Submit(ctx, createSubmitInput(person("E", "John", "Doe", "smith@example.com")))
+	assert.NoError(t, err)
+	merged := fixture.Entities()
+	if assert.Len(t, merged, 1) {
+		assert.Equal(t, before[0].ID, merged[0].ID)
+		assert.Equal(t, []string{"A", "B", "C", "D", "E"}, ids(merged[0].Records))
+	}
+
+	// split by evicting A
+	_, err = fixture.Submit(ctx, createSubmitInput(person("F", "Max", "Mustermann", "max@example.com")))
+	assert.NoError(t, err)
+	split := fixture.Entities()
+	if assert.Len(t, split, 3) {
+		assert.Equal(t, []string{"B"}, ids(split[0].Records))
+		assert.Equal(t, []string{"C", "D", "E"}, ids(split[1].Records))
+		assert.Equal(t, before[0].ID, split[1].ID, "largest part must keep the id")
+		assert.Equal(t, []string{"F"}, ids(split[2].Records))
+	}
+
+	// update
+	_, err = fixture.Submit(ctx, createSubmitInput(person("C", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err)
+	updated := fixture.Entities()
+	if assert.Len(t, updated, 3) {
+		assert.Equal(t, []string{"B", "C"}, ids(updated[0].Records))
+		assert.Equal(t, split[0].ID, updated[0].ID)
+		assert.Equal(t, []string{"D", "E"}, ids(updated[1].Records))
+		assert.Equal(t, before[0].ID, updated[1].ID)
+		assert.Equal(t, []string{"F"}, ids(updated[2].Records))
+	}
+	assert.Len(t, fixture.Records(), 5)
+}
+
+func TestFakeDispatcherClusteringSearch(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+		person("C", "John", "Doe", "john@example.com"),
+	))
+	assert.NoError(t, err)
+
+	actual, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"firstName": "Anna",
+		"lastName":  "Smith",
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, actual.Entities, 1) {
+		assert.Equal(t, []string{"A", "B"}, ids(actual.Entities[0].Records))
+		assert.Equal(t, api.Hits{"A": {"R1"}}, actual.Entities[0].Hits)
+	}
+
+	actual, err = fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"firstName": "John",
+		"email":     "anna@example.com",
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, actual.Entities, 1) {
+		assert.Equal(t, api.Hits{"A": {"R2"}, "B": {"R2"}}, actual.Entities[0].Hits)
+	}
+
+	actual, err = fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"firstName": "John",
+	}})
+	assert.NoError(t, err)
+	assert.NotNil(t, actual.Entities)
+	assert.Empty(t, actual.Entities)
+}
+
+func TestFakeDispatcherClusteringSearchModeAny(t *testing.T) {
+	fixture := &FakeDispatcher{
+		Rules:      []Rule{{ID: "R1", Fields: []string{"firstName", "lastName"}}},
+		SearchMode: SearchModeAny,
+	}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "smith@example.com"),
+		person("C", "John", "Smith", "anna@example.com"),
+		person("D", "John", "Doe", "john@example.com"),
+	))
+	assert.NoError(t, err)
+
+	output, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"lastName":     "Smith",
+		"email":        "anna@example.com",
+		SearchScoreKey: true,
+	}})
+	assert.NoError(t, err)
+	if !assert.Len(t, output.Entities, 2) {
+		return
+	}
+	assert.Equal(t, []string{"A", "B"}, ids(output.Entities[0].Records))
+	assert.Equal(t, api.Hits{"A": {"email", "lastName"}, "B": {"lastName"}, SearchScoreKey: {"2"}}, output.Entities[0].Hits)
+	assert.Equal(t, []string{"C"}, ids(output.Entities[1].Records))
+	assert.Equal(t, api.Hits{"C": {"email", "lastName"}, SearchScoreKey: {"2"}}, output.Entities[1].Hits)
+
+	fixture.SearchMode = SearchModeRules
+	output, err = fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"lastName": "Smith",
+		"email":    "anna@example.com",
+	}})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Entities)
+}
+
+func TestFakeDispatcherClusteringIsIncremental(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules, Capacity: 20}
+	ctx := context.Background()
+	random := rand.New(rand.NewSource(1))
+	names := []string{"Anna", "Ann", "John"}
+	for i := 0; i < 200; i++ {
+		id := strconv.Itoa(random.Intn(30))
+		var err error
+		if random.Intn(4) == 0 {
+			_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+				RecordIDs:           []string{id},
+				CreateConnectionBan: random.Intn(2) == 0,
+			})
+		} else {
+			_, err = fixture.Submit(ctx, createSubmitInput(person(
+				id,
+				names[random.Intn(len(names))],
+				"Smith",
+				strconv.Itoa(random.Intn(10))+"@example.com",
+			)))
+		}
+		if err != nil {
+			continue // unknown record
+		}
+
+		store := fixture.entityStore()
+		expected := store.components(store.recordIDs())
+		actual := [][]string{}
+		for _, entity := range fixture.Entities() {
+			actual = append(actual, ids(entity.Records))
+			for _, record := range entity.Records {
+				assert.Equal(t, entity.ID, store.entityIDs[record.ID])
+			}
+		}
+		if !assert.Equal(t, expected, actual, "step %v", i) {
+			return
+		}
+		assert.Len(t, store.entityIDs, len(store.records))
+		assert.Len(t, fixture.recordHistory().current, len(store.records))
+	}
+}
+
+func person(id, firstName, lastName, email string) *api.Record {
+	return &api.Record{
+		ID: id,
+		Data: map[string]interface{}{
+			"firstName": firstName,
+			"lastName":  lastName,
+			"email":     email,
+		},
+	}
+}
+
+func ids(records []*api.Record) []string {
+	recordIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		recordIDs = append(recordIDs, record.ID)
+	}
+	return recordIDs
+}
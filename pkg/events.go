@@ -0,0 +1,253 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// event types
+const (
+	EventRecordAdded          = "recordAdded"
+	EventRecordDeleted        = "recordDeleted"
+	EventEntityCreated        = "entityCreated"
+	EventEntitiesMerged       = "entitiesMerged"
+	EventEntitySplit          = "entitySplit"
+	EventEntityDeleted        = "entityDeleted"
+	EventConnectionBanCreated = "connectionBanCreated"
+	EventConnectionBanRemoved = "connectionBanRemoved"
+)
+
+// DefaultEventCapacity is the number of kept events if no event capacity was
+// configured
+const DefaultEventCapacity = 1000
+
+// DefaultEventsLimit is the maximum number of returned events if no limit was
+// provided
+const DefaultEventsLimit = 100
+
+// MaxEventsTimeout is the maximum time to wait for new events, which is below
+// the default timeout of plugin calls
+const MaxEventsTimeout = 25 * time.Second
+
+// Event describes a change of records, entities or connection bans
+//
+// Depending on the type, the event contains:
+//
+//	recordAdded:          RecordID and EntityID (empty without rules)
+//	recordDeleted:        RecordID and previous EntityID (empty without rules)
+//	entityCreated:        EntityID
+//	entitiesMerged:       EntityID of the result and EntityIDs of the merged entities
+//	entitySplit:          EntityID of the split entity and EntityIDs of the results
+//	entityDeleted:        EntityID
+//	connectionBanCreated: EntityIDs of the banned entities
+//	connectionBanRemoved: EntityID and EntityIDs of the others
+type Event struct {
+	Sequence  int64     `json:"sequence"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	EntityID  string    `json:"entityID,omitempty"`
+	RecordID  string    `json:"recordID,omitempty"`
+	EntityIDs []string  `json:"entityIDs,omitempty"`
+}
+
+// EventsInput includes the data required to read events
+type EventsInput struct {
+	// After is the cursor, only events with a larger sequence are returned
+	After int64 `json:"after"`
+
+	// Limit is the maximum number of returned events, defaults to 100
+	Limit int `json:"limit"`
+
+	// Timeout defines how long to wait for new events if there are none yet,
+	// returns immediately if nil and waits at most 25 seconds
+	Timeout *time.Duration `json:"timeout"`
+}
+
+// EventsOutput contains the events ordered by their sequence and the cursor
+// for reading the next events
+type EventsOutput struct {
+	Events []Event `json:"events"`
+	Cursor int64   `json:"cursor"`
+}
+
+// Events returns the events after the given cursor, waiting for new events if
+// requested
+//
+// Only the most recent events are kept, therefore events may be missing if the
+// cursor is too old. This can be detected using the events sequence.
+func (f *FakeDispatcher) Events(ctx context.Context, input *EventsInput) (*EventsOutput, error) {
+	limit := input.Limit
+	if limit <= 0 {
+		limit = DefaultEventsLimit
+	}
+	timeout := time.Duration(0)
+	if input.Timeout != nil {
+		timeout = *input.Timeout
+	}
+	if timeout > MaxEventsTimeout {
+		timeout = MaxEventsTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		f.mu.Lock()
+		events := f.eventsAfter(input.After, limit)
+		changed := f.eventsChanged()
+		f.mu.Unlock()
+
+		if len(events) != 0 || timeout <= 0 {
+			output := &EventsOutput{
+				Events: events,
+				Cursor: input.After,
+			}
+			if len(events) != 0 {
+				output.Cursor = events[len(events)-1].Sequence
+			}
+			return output, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			timeout = 0
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// eventsAfter returns a copy of up to limit events after the given sequence
+func (f *FakeDispatcher) eventsAfter(after int64, limit int) []Event {
+	events := []Event{}
+	if len(f.events) == 0 {
+		return events
+	}
+	start := int(after - f.events[0].Sequence + 1)
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(f.events) && len(events) < limit; i++ {
+		events = append(events, f.events[i])
+	}
+	return events
+}
+
+// eventsChanged returns a channel that is closed once new events are emitted
+func (f *FakeDispatcher) eventsChanged() <-chan struct{} {
+	if f.eventSignal == nil {
+		f.eventSignal = make(chan struct{})
+	}
+	return f.eventSignal
+}
+
+// emit assigns the sequence and time to the events, adds them and writes them
+// to the event log
+//
+// Since the events describe changes that already happened, errors while writing
+// the event log are passed to OnError instead of failing the call.
+func (f *FakeDispatcher) emit(now time.Time, events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	var err error
+	for i := range events {
+		f.lastEvent++
+		events[i].Sequence = f.lastEvent
+		events[i].Time = now
+		f.events = append(f.events, events[i])
+		if f.EventLog != nil && err == nil {
+			err = f.writeEvent(events[i])
+		}
+	}
+	if err != nil {
+		f.reportError(err)
+	}
+
+	// trimming only once the capacity is exceeded twice avoids copying on
+	// every event
+	capacity := f.eventCapacity()
+	if len(f.events) >= 2*capacity {
+		f.events = append([]Event(nil), f.events[len(f.events)-capacity:]...)
+	}
+
+	if f.eventSignal != nil {
+		close(f.eventSignal)
+		f.eventSignal = nil
+	}
+}
+
+func (f *FakeDispatcher) writeEvent(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = f.EventLog.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+	return nil
+}
+
+func (f *FakeDispatcher) eventCapacity() int {
+	if f.EventCapacity <= 0 {
+		return DefaultEventCapacity
+	}
+	return f.EventCapacity
+}
+
+// entityEvents returns the events that describe the changes between the
+// previous entities and the rebuilt entities of the store, which are ordered by
+// their oldest record
+func entityEvents(previous map[string][]string, rebuilt []string, store *entityStore) []Event {
+	previousEntityIDs := map[string]string{}
+	for entityID, recordIDs := range previous {
+		for _, recordID := range recordIDs {
+			previousEntityIDs[recordID] = entityID
+		}
+	}
+
+	events := []Event{}
+	for _, entityID := range rebuilt {
+		sources := uniqueEntityIDs(store.entities[entityID], previousEntityIDs)
+		switch {
+		case len(sources) == 0:
+			events = append(events, Event{Type: EventEntityCreated, EntityID: entityID})
+		case len(sources) > 1:
+			events = append(events, Event{Type: EventEntitiesMerged, EntityID: entityID, EntityIDs: sources})
+		}
+	}
+
+	previousIDs := make([]string, 0, len(previous))
+	for entityID := range previous {
+		previousIDs = append(previousIDs, entityID)
+	}
+	sort.Strings(previousIDs)
+	for _, entityID := range previousIDs {
+		targets := uniqueEntityIDs(previous[entityID], store.entityIDs)
+		switch {
+		case len(targets) == 0:
+			events = append(events, Event{Type: EventEntityDeleted, EntityID: entityID})
+		case len(targets) > 1:
+			events = append(events, Event{Type: EventEntitySplit, EntityID: entityID, EntityIDs: targets})
+		}
+	}
+	return events
+}
+
+// uniqueEntityIDs returns the distinct entity ids of the given records in
+// order of their first occurrence, ignoring records without entity
+func uniqueEntityIDs(recordIDs []string, entityIDs map[string]string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, recordID := range recordIDs {
+		entityID, ok := entityIDs[recordID]
+		if ok && !seen[entityID] {
+			seen[entityID] = true
+			unique = append(unique, entityID)
+		}
+	}
+	return unique
+}
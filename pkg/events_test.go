@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestEvents(t *testing.T) {
+	log := &bytes.Buffer{}
+	fixture := &FakeDispatcher{Rules: testRules, EventLog: log}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	e1 := fixture.Entities()[0].ID
+	_, err = fixture.Submit(ctx, createSubmitInput(person("C", "John", "Doe", "john@example.com")))
+	assert.NoError(t, err)
+	e2 := fixture.Entities()[1].ID
+	_, err = fixture.Submit(ctx, createSubmitInput(person("D", "John", "Doe", "anna@example.com")))
+	assert.NoError(t, err)
+	output, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		RecordIDs:           []string{"D"},
+		CreateConnectionBan: true,
+	})
+	assert.NoError(t, err)
+	e3 := output.EntityIDs[1]
+
+	expected := []Event{
+		{Sequence: 1, Type: EventRecordAdded, RecordID: "A", EntityID: e1},
+		{Sequence: 2, Type: EventRecordAdded, RecordID: "B", EntityID: e1},
+		{Sequence: 3, Type: EventEntityCreated, EntityID: e1},
+		{Sequence: 4, Type: EventRecordAdded, RecordID: "C", EntityID: e2},
+		{Sequence: 5, Type: EventEntityCreated, EntityID: e2},
+		{Sequence: 6, Type: EventRecordAdded, RecordID: "D", EntityID: e1},
+		{Sequence: 7, Type: EventEntitiesMerged, EntityID: e1, EntityIDs: []string{e1, e2}},
+		{Sequence: 8, Type: EventEntitySplit, EntityID: e1, EntityIDs: []string{e1, e3}},
+		{Sequence: 9, Type: EventConnectionBanCreated, EntityIDs: []string{e1, e3}},
+	}
+	actual, err := fixture.Events(ctx, &EventsInput{})
+	assert.NoError(t, err)
+	for i := range actual.Events {
+		actual.Events[i].Time = time.Time{}
+	}
+	assert.Equal(t, expected, actual.Events)
+	assert.Equal(t, int64(9), actual.Cursor)
+
+	actual, err = fixture.Events(ctx, &EventsInput{After: 3, Limit: 2})
+	assert.NoError(t, err)
+	if assert.Len(t, actual.Events, 2) {
+		assert.Equal(t, int64(4), actual.Events[0].Sequence)
+	}
+	assert.Equal(t, int64(5), actual.Cursor)
+
+	actual, err = fixture.Events(ctx, &EventsInput{After: 9})
+	assert.NoError(t, err)
+	assert.Empty(t, actual.Events)
+	assert.Equal(t, int64(9), actual.Cursor)
+
+	assert.Equal(t, 9, strings.Count(log.String(), "\n"))
+}
+
+func TestEventsConnectionBanWithoutSplit(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	output, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		RecordIDs:           []string{"B"},
+		CreateConnectionBan: true,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, output.EntityIDs, 1)
+
+	actual, err := fixture.Events(ctx, &EventsInput{})
+	assert.NoError(t, err)
+	for _, event := range actual.Events {
+		assert.NotEqual(t, EventConnectionBanCreated, event.Type, "no connection ban was created")
+	}
+}
+
+func TestEventsCapacity(t *testing.T) {
+	fixture := &FakeDispatcher{EventCapacity: 2}
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		_, err := fixture.Submit(ctx, createSubmitInput(record(id)))
+		assert.NoError(t, err)
+	}
+
+	actual, err := fixture.Events(ctx, &EventsInput{})
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, actual.Events) {
+		assert.GreaterOrEqual(t, actual.Events[0].Sequence, int64(2))
+		assert.Equal(t, "5", actual.Events[len(actual.Events)-1].RecordID)
+		assert.Equal(t, "", actual.Events[len(actual.Events)-1].EntityID)
+	}
+}
+
+func TestEventLogFailure(t *testing.T) {
+	errs := []error{}
+	fixture := &FakeDispatcher{Rules: testRules, EventLog: failingWriter{}, OnError: func(err error) {
+		errs = append(errs, err)
+	}}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(person("A", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err, "the records are already stored")
+	assert.Len(t, fixture.Entities(), 1)
+	_, err = fixture.DeleteRecords(ctx, &DeleteRecordsInput{RecordIDs: []string{"A"}})
+	assert.NoError(t, err, "the records are already deleted")
+	assert.Empty(t, fixture.Entities())
+	if assert.Len(t, errs, 2) {
+		assert.EqualError(t, errs[0], "failed to write event log: disk full")
+	}
+
+	actual, err := fixture.Events(ctx, &EventsInput{})
+	assert.NoError(t, err)
+	assert.Len(t, actual.Events, 4)
+}
+
+func TestEventsLongPoll(t *testing.T) {
+	fixture := &FakeDispatcher{}
+	ctx := context.Background()
+
+	timeout := 5 * time.Second
+	result := make(chan *EventsOutput)
+	go func() {
+		output, err := fixture.Events(ctx, &EventsInput{Timeout: &timeout})
+		assert.NoError(t, err)
+		result <- output
+	}()
+	time.Sleep(50 * time.Millisecond)
+	_, err := fixture.Submit(ctx, createSubmitInput(record("1")))
+	assert.NoError(t, err)
+
+	select {
+	case output := <-result:
+		if assert.Len(t, output.Events, 1) {
+			assert.Equal(t, "1", output.Events[0].RecordID)
+		}
+	case <-time.After(timeout):
+		assert.Fail(t, "long poll did not return after new events")
+	}
+
+	timeout = 10 * time.Millisecond
+	output, err := fixture.Events(ctx, &EventsInput{After: 1, Timeout: &timeout})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Events)
+	assert.Equal(t, int64(1), output.Cursor)
+}
+
+func TestEntityDeletedEvent(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules, Capacity: 1}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(person("A", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err)
+	e1 := fixture.Entities()[0].ID
+	_, err = fixture.Submit(ctx, createSubmitInput(person("B", "John", "Doe", "john@example.com")))
+	assert.NoError(t, err)
+	e2 := fixture.Entities()[0].ID
+
+	actual, err := fixture.Events(ctx, &EventsInput{After: 2})
+	assert.NoError(t, err)
+	types := []string{}
+	for _, event := range actual.Events {
+		types = append(types, event.Type+" "+event.EntityID)
+	}
+	assert.Equal(t, []string{
+		EventRecordAdded + " " + e2,
+		EventEntityCreated + " " + e2,
+		EventEntityDeleted + " " + e1,
+	}, types)
+}
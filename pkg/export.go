@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg/graph"
+)
+
+// ExportInput defines which entities to export in which format
+type ExportInput struct {
+	// EntityID of the entity to export, all entities are exported if empty
+	EntityID string `json:"entityID"`
+
+	// Format is one of "dot", "graphml" or "json"
+	Format string `json:"format"`
+}
+
+// ExportOutput contains the exported graph
+type ExportOutput struct {
+	Graph string `json:"graph"`
+}
+
+// Export exports one or all entities as graph
+//
+// Records are exported as nodes, edges as links labelled with the rule ID and
+// duplicates are highlighted.
+func (f *FakeDispatcher) Export(ctx context.Context, input *ExportInput) (*ExportOutput, error) {
+	var entities []*api.Entity
+	if input.EntityID == "" {
+		entities = f.Entities()
+	} else {
+		output, err := f.Entity(ctx, &dispatcher.EntityInput{ID: input.EntityID})
+		if err != nil {
+			return nil, err
+		}
+		if output.Entity == nil {
+			return nil, fmt.Errorf("entity %v not found", input.EntityID)
+		}
+		entities = []*api.Entity{output.Entity}
+	}
+
+	buf := &bytes.Buffer{}
+	err := graph.New(entities).Write(buf, input.Format)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportOutput{
+		Graph: buf.String(),
+	}, nil
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "anna@example.com"),
+		person("C", "John", "Doe", "john@example.com"),
+	))
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+
+	actual, err := fixture.Export(ctx, &ExportInput{EntityID: entities[0].ID, Format: "dot"})
+	assert.NoError(t, err)
+	assert.Equal(t, `graph entities {
+  node [shape=box];
+  subgraph cluster_0 {
+    label="entity `+entities[0].ID+`";
+    "A";
+    "B" [label="B\n(duplicate of A)", style=filled, fillcolor=orange];
+  }
+  "A" -- "B" [label="R1"];
+  "A" -- "B" [label="R2"];
+  "A" -- "B" [style=dashed, color=orange, label=duplicate];
+}
+`, actual.Graph)
+
+	actual, err = fixture.Export(ctx, &ExportInput{Format: "json"})
+	assert.NoError(t, err)
+	assert.Contains(t, actual.Graph, `"id": "C"`)
+
+	_, err = fixture.Export(ctx, &ExportInput{EntityID: "unknown", Format: "dot"})
+	assert.EqualError(t, err, "entity unknown not found")
+
+	_, err = fixture.Export(ctx, &ExportInput{Format: "svg"})
+	assert.EqualError(t, err, "unsupported graph format svg, must be one of dot, graphml or json")
+}
+
+func TestExportViaAdmin(t *testing.T) {
+	p, err := StartInProcess(&FakeDispatcher{Rules: testRules})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+	ctx := context.Background()
+	_, err = p.Dispatcher.Submit(ctx, createSubmitInput(person("A", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err)
+
+	actual, err := p.Admin.Export(ctx, &ExportInput{Format: "graphml"})
+	assert.NoError(t, err)
+	assert.Contains(t, actual.Graph, `<node id="A">`)
+
+	_, err = p.Admin.Export(ctx, &ExportInput{Format: "svg"})
+	assert.EqualError(t, err, "unsupported graph format svg, must be one of dot, graphml or json")
+}
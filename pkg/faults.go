@@ -0,0 +1,142 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// Fault defines the failures that are injected into the calls of a method
+type Fault struct {
+	// ErrorRate is the probability between 0 and 1 that a call fails without
+	// being forwarded
+	ErrorRate float64 `yaml:"errorRate"`
+
+	// Latency delays every call, including the failing ones
+	Latency time.Duration `yaml:"latency"`
+}
+
+// ValidateFaults returns an error if any fault refers to an unknown method or
+// has an invalid error rate or latency
+func ValidateFaults(faults map[string]Fault) error {
+	// sorted to report the same error for the same faults
+	methods := make([]string, 0, len(faults))
+	for method := range faults {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		fault := faults[method]
+		switch method {
+		case methodEntity, methodSubmit, methodSearch, methodDisassemble, methodRemoveConnectionBan:
+		default:
+			return fmt.Errorf("unknown method %v, must be one of %v, %v, %v, %v or %v", method, methodEntity, methodSubmit, methodSearch, methodDisassemble, methodRemoveConnectionBan)
+		}
+		if fault.ErrorRate < 0 || fault.ErrorRate > 1 {
+			return fmt.Errorf("invalid error rate %v of method %v, must be between 0 and 1", fault.ErrorRate, method)
+		}
+		if fault.Latency < 0 {
+			return fmt.Errorf("invalid latency %v of method %v, must not be negative", fault.Latency, method)
+		}
+	}
+	return nil
+}
+
+// FaultInjector wraps a Dispatcher and injects latency and errors into its
+// calls, e.g. to test timeouts and retries of clients
+//
+// Failing calls are not forwarded, so they never modify the wrapped Dispatcher.
+type FaultInjector struct {
+	dispatcher dispatcher.Dispatcher
+	faults     map[string]Fault
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// NewFaultInjector returns a FaultInjector that forwards all calls to the
+// given Dispatcher after injecting the faults configured per method name, e.g.
+// "Submit"
+func NewFaultInjector(d dispatcher.Dispatcher, faults map[string]Fault) *FaultInjector {
+	return &FaultInjector{
+		dispatcher: d,
+		faults:     faults,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())), // nolint:gosec
+	}
+}
+
+// Entity forwards the Entity call unless a fault is injected
+func (i *FaultInjector) Entity(ctx context.Context, input *dispatcher.EntityInput) (*dispatcher.EntityOutput, error) {
+	err := i.inject(ctx, methodEntity)
+	if err != nil {
+		return nil, err
+	}
+	return i.dispatcher.Entity(ctx, input)
+}
+
+// Submit forwards the Submit call unless a fault is injected
+func (i *FaultInjector) Submit(ctx context.Context, input *dispatcher.SubmitInput) (*dispatcher.SubmitOutput, error) {
+	err := i.inject(ctx, methodSubmit)
+	if err != nil {
+		return nil, err
+	}
+	return i.dispatcher.Submit(ctx, input)
+}
+
+// Search forwards the Search call unless a fault is injected
+func (i *FaultInjector) Search(ctx context.Context, input *dispatcher.SearchInput) (*dispatcher.SearchOutput, error) {
+	err := i.inject(ctx, methodSearch)
+	if err != nil {
+		return nil, err
+	}
+	return i.dispatcher.Search(ctx, input)
+}
+
+// Disassemble forwards the Disassemble call unless a fault is injected
+func (i *FaultInjector) Disassemble(ctx context.Context, input *dispatcher.DisassembleInput) (*dispatcher.DisassembleOutput, error) {
+	err := i.inject(ctx, methodDisassemble)
+	if err != nil {
+		return nil, err
+	}
+	return i.dispatcher.Disassemble(ctx, input)
+}
+
+// RemoveConnectionBan forwards the RemoveConnectionBan call unless a fault is
+// injected
+func (i *FaultInjector) RemoveConnectionBan(ctx context.Context, input *dispatcher.RemoveConnectionBanInput) error {
+	err := i.inject(ctx, methodRemoveConnectionBan)
+	if err != nil {
+		return err
+	}
+	return i.dispatcher.RemoveConnectionBan(ctx, input)
+}
+
+// inject waits for the latency of the method and returns an error for the
+// configured rate of calls or if the context is done while waiting
+func (i *FaultInjector) inject(ctx context.Context, method string) error {
+	fault, ok := i.faults[method]
+	if !ok {
+		return nil
+	}
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	i.mu.Lock()
+	failed := i.random.Float64() < fault.ErrorRate
+	i.mu.Unlock()
+	if failed {
+		return fmt.Errorf("injected fault in %v", method)
+	}
+	return nil
+}
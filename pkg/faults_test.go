@@ -0,0 +1,50 @@
+package pkg
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestFaultInjector(t *testing.T) {
+	fake := &FakeDispatcher{}
+	d := NewFaultInjector(fake, map[string]Fault{
+		methodSubmit: {ErrorRate: 1},
+		methodSearch: {ErrorRate: 0.5},
+		methodEntity: {Latency: 10 * time.Millisecond},
+	})
+	d.random = rand.New(rand.NewSource(1)) // nolint:gosec
+	ctx := context.Background()
+
+	_, err := d.Submit(ctx, createSubmitInput(record("1")))
+	assert.EqualError(t, err, "injected fault in Submit")
+	assert.Empty(t, fake.Records())
+
+	failed := 0
+	for i := 0; i < 100; i++ {
+		_, err = d.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{}})
+		if err != nil {
+			failed++
+		}
+	}
+	assert.InDelta(t, 50, failed, 15)
+
+	start := time.Now()
+	_, err = d.Entity(ctx, &dispatcher.EntityInput{ID: "E"})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(10*time.Millisecond))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = d.Entity(canceled, &dispatcher.EntityInput{ID: "E"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = d.RemoveConnectionBan(ctx, &dispatcher.RemoveConnectionBanInput{})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "injected fault")
+}
@@ -0,0 +1,173 @@
+// Package generator creates synthetic person records with controlled
+// duplicates for load and UX testing.
+//
+// Each generated record belongs to exactly one real world person. The mapping
+// of record IDs to these persons is returned as ground truth, which allows
+// comparing the entities created by a dispatcher against the expected result.
+package generator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// Config defines how many and which kind of records will be generated
+type Config struct {
+	// Persons is the number of distinct real world persons
+	Persons int
+
+	// ExactDuplicateRate is the probability for each person to get an
+	// additional record with exactly the same data
+	ExactDuplicateRate float64
+
+	// FuzzyDuplicateRate is the probability for each person to get an
+	// additional record with slightly modified data, e.g. typos or different
+	// formatting
+	FuzzyDuplicateRate float64
+
+	// Seed initializes the random generator, the same seed always generates
+	// the same records
+	Seed int64
+}
+
+// GroundTruth maps each record ID to the ID of its real world person
+type GroundTruth map[string]string
+
+// Result contains the generated records and their ground truth
+type Result struct {
+	Records     []*api.Record
+	GroundTruth GroundTruth
+}
+
+// Generate creates the records as defined in the config
+//
+// The records of one person are not adjacent but shuffled across the result.
+func Generate(config Config) (*Result, error) {
+	if config.Persons < 0 {
+		return nil, fmt.Errorf("persons must not be negative, got %v", config.Persons)
+	}
+	if config.ExactDuplicateRate < 0 || config.ExactDuplicateRate > 1 {
+		return nil, fmt.Errorf("exact duplicate rate must be between 0 and 1, got %v", config.ExactDuplicateRate)
+	}
+	if config.FuzzyDuplicateRate < 0 || config.FuzzyDuplicateRate > 1 {
+		return nil, fmt.Errorf("fuzzy duplicate rate must be between 0 and 1, got %v", config.FuzzyDuplicateRate)
+	}
+
+	rnd := rand.New(rand.NewSource(config.Seed)) // nolint:gosec
+	result := &Result{
+		Records:     make([]*api.Record, 0, config.Persons),
+		GroundTruth: GroundTruth{},
+	}
+	add := func(personID string, data map[string]interface{}) {
+		id := fmt.Sprintf("record-%07d", len(result.Records)+1)
+		result.Records = append(result.Records, &api.Record{
+			ID:   id,
+			Data: data,
+		})
+		result.GroundTruth[id] = personID
+	}
+
+	for i := 1; i <= config.Persons; i++ {
+		personID := fmt.Sprintf("person-%07d", i)
+		data := person(rnd)
+		add(personID, data)
+		if rnd.Float64() < config.ExactDuplicateRate {
+			add(personID, copyData(data))
+		}
+		if rnd.Float64() < config.FuzzyDuplicateRate {
+			add(personID, fuzzy(rnd, data))
+		}
+	}
+
+	// shuffle only the data, so that the record IDs remain in ascending order
+	rnd.Shuffle(len(result.Records), func(i, j int) {
+		a, b := result.Records[i], result.Records[j]
+		a.Data, b.Data = b.Data, a.Data
+		result.GroundTruth[a.ID], result.GroundTruth[b.ID] = result.GroundTruth[b.ID], result.GroundTruth[a.ID]
+	})
+	return result, nil
+}
+
+// Seed submits all records in batches of the given size to the dispatcher
+func Seed(ctx context.Context, d dispatcher.Dispatcher, records []*api.Record, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = len(records)
+	}
+	for start := 0; start < len(records); start += batchSize {
+		end := start + batchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		_, err := d.Submit(ctx, &dispatcher.SubmitInput{Records: records[start:end]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteRecords writes the records as one JSON object per line
+func WriteRecords(w io.Writer, records []*api.Record) error {
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRecords reads records that are stored as one JSON object per line
+func ReadRecords(r io.Reader) ([]*api.Record, error) {
+	records := []*api.Record{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		record := &api.Record{}
+		err := json.Unmarshal(scanner.Bytes(), record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record in line %v: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// WriteGroundTruth writes the ground truth as a single JSON object
+func WriteGroundTruth(w io.Writer, groundTruth GroundTruth) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(groundTruth)
+}
+
+// ReadGroundTruth reads a ground truth that is stored as a single JSON object
+func ReadGroundTruth(r io.Reader) (GroundTruth, error) {
+	groundTruth := GroundTruth{}
+	err := json.NewDecoder(r).Decode(&groundTruth)
+	if err != nil {
+		return nil, err
+	}
+	return groundTruth, nil
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+	return c
+}
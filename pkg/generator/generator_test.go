@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg"
+)
+
+func TestGenerate(t *testing.T) {
+	config := Config{
+		Persons:            1000,
+		ExactDuplicateRate: 0.1,
+		FuzzyDuplicateRate: 0.2,
+		Seed:               42,
+	}
+	actual, err := Generate(config)
+	assert.NoError(t, err)
+
+	assert.Greater(t, len(actual.Records), 1250)
+	assert.Less(t, len(actual.Records), 1350)
+	assert.Len(t, actual.GroundTruth, len(actual.Records))
+
+	persons := map[string]int{}
+	for _, record := range actual.Records {
+		persons[actual.GroundTruth[record.ID]]++
+		for _, key := range []string{"firstName", "lastName", "dateOfBirth", "email", "phone", "street", "zip", "city"} {
+			assert.NotEmpty(t, record.Data[key], "%v of %v", key, record.ID)
+		}
+	}
+	assert.Len(t, persons, 1000)
+
+	again, err := Generate(config)
+	assert.NoError(t, err)
+	assert.Equal(t, actual, again)
+}
+
+func TestGenerateDuplicates(t *testing.T) {
+	exact, err := Generate(Config{Persons: 100, ExactDuplicateRate: 1})
+	assert.NoError(t, err)
+	assert.Len(t, exact.Records, 200)
+	byPerson := map[string][]map[string]interface{}{}
+	for _, record := range exact.Records {
+		personID := exact.GroundTruth[record.ID]
+		byPerson[personID] = append(byPerson[personID], record.Data)
+	}
+	for personID, data := range byPerson {
+		if assert.Len(t, data, 2, personID) {
+			assert.Equal(t, data[0], data[1], personID)
+		}
+	}
+
+	fuzzy, err := Generate(Config{Persons: 100, FuzzyDuplicateRate: 1})
+	assert.NoError(t, err)
+	assert.Len(t, fuzzy.Records, 200)
+	byPerson = map[string][]map[string]interface{}{}
+	for _, record := range fuzzy.Records {
+		personID := fuzzy.GroundTruth[record.ID]
+		byPerson[personID] = append(byPerson[personID], record.Data)
+	}
+	for personID, data := range byPerson {
+		if assert.Len(t, data, 2, personID) {
+			assert.NotEqual(t, data[0], data[1], personID)
+			assert.Equal(t, data[0]["city"], data[1]["city"], personID)
+		}
+	}
+}
+
+func TestGenerateInvalidConfig(t *testing.T) {
+	_, err := Generate(Config{Persons: -1})
+	assert.EqualError(t, err, "persons must not be negative, got -1")
+	_, err = Generate(Config{Persons: 1, ExactDuplicateRate: 1.5})
+	assert.EqualError(t, err, "exact duplicate rate must be between 0 and 1, got 1.5")
+	_, err = Generate(Config{Persons: 1, FuzzyDuplicateRate: -0.1})
+	assert.EqualError(t, err, "fuzzy duplicate rate must be between 0 and 1, got -0.1")
+}
+
+func TestReadAndWrite(t *testing.T) {
+	generated, err := Generate(Config{Persons: 10, FuzzyDuplicateRate: 0.5, Seed: 1})
+	assert.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteRecords(buf, generated.Records))
+	records, err := ReadRecords(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.Records, records)
+
+	buf.Reset()
+	assert.NoError(t, WriteGroundTruth(buf, generated.GroundTruth))
+	groundTruth, err := ReadGroundTruth(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.GroundTruth, groundTruth)
+
+	_, err = ReadRecords(bytes.NewBufferString("{}\n\n[]\n"))
+	assert.EqualError(t, err, "invalid record in line 3: json: cannot unmarshal array into Go value of type api.Record")
+}
+
+func TestSeed(t *testing.T) {
+	generated, err := Generate(Config{Persons: 250, Seed: 1})
+	assert.NoError(t, err)
+
+	fake := &pkg.FakeDispatcher{Capacity: 1000}
+	err = Seed(context.Background(), fake, generated.Records, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, generated.Records, fake.Records())
+
+	entity, err := fake.Entity(context.Background(), &dispatcher.EntityInput{ID: "some-id"})
+	assert.NoError(t, err)
+	assert.Len(t, entity.Entity.Records, 250)
+}
@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+var firstNames = []string{
+	"Emma", "Olivia", "Sophia", "Mia", "Hannah", "Lena", "Anna", "Marie", "Lea", "Laura",
+	"Noah", "Liam", "Ben", "Paul", "Jonas", "Elias", "Leon", "Finn", "Lukas", "Felix",
+	"James", "John", "Robert", "Michael", "William", "David", "Richard", "Thomas", "Mary", "Linda",
+}
+
+var lastNames = []string{
+	"Smith", "Johnson", "Williams", "Brown", "Jones", "Miller", "Davis", "Wilson", "Anderson", "Taylor",
+	"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann",
+	"Martin", "Bernard", "Dubois", "Moreau", "Laurent", "Garcia", "Martinez", "Rossi", "Russo", "Novak",
+}
+
+var streets = []string{
+	"Oak Street", "Maple Avenue", "Cedar Road", "Park Lane", "Church Street", "High Street",
+	"Station Road", "Mill Lane", "Victoria Road", "Green Lane", "King Street", "Queen Street",
+}
+
+var cities = []struct {
+	name string
+	zip  string
+}{
+	{"London", "SW1A"}, {"Manchester", "M1"}, {"Leeds", "LS1"}, {"Bristol", "BS1"},
+	{"Berlin", "10115"}, {"Hamburg", "20095"}, {"Munich", "80331"}, {"Cologne", "50667"},
+}
+
+var emailDomains = []string{"example.com", "example.org", "mail.example.net", "gmail.com"}
+
+// streetAbbreviations are used to create fuzzy duplicates of addresses
+var streetAbbreviations = map[string]string{
+	"Street": "St.",
+	"Avenue": "Ave",
+	"Road":   "Rd.",
+	"Lane":   "Ln",
+}
+
+func person(rnd *rand.Rand) map[string]interface{} {
+	firstName := pick(rnd, firstNames)
+	lastName := pick(rnd, lastNames)
+	city := cities[rnd.Intn(len(cities))]
+	return map[string]interface{}{
+		"firstName":   firstName,
+		"lastName":    lastName,
+		"dateOfBirth": fmt.Sprintf("%04d-%02d-%02d", 1940+rnd.Intn(65), 1+rnd.Intn(12), 1+rnd.Intn(28)),
+		"email":       fmt.Sprintf("%v.%v%v@%v", strings.ToLower(firstName), strings.ToLower(lastName), rnd.Intn(100), pick(rnd, emailDomains)),
+		"phone":       fmt.Sprintf("+44 7%03d %06d", rnd.Intn(1000), rnd.Intn(1000000)),
+		"street":      fmt.Sprintf("%v %v", 1+rnd.Intn(200), pick(rnd, streets)),
+		"zip":         city.zip,
+		"city":        city.name,
+	}
+}
+
+// fuzzy returns a modified copy of data
+//
+// Between one and three fields are modified in a way that a human would still
+// consider the record to belong to the same person.
+func fuzzy(rnd *rand.Rand, data map[string]interface{}) map[string]interface{} {
+	modifications := []func(map[string]interface{}){
+		func(d map[string]interface{}) { d["firstName"] = typo(rnd, d["firstName"].(string)) },
+		func(d map[string]interface{}) { d["lastName"] = typo(rnd, d["lastName"].(string)) },
+		func(d map[string]interface{}) { d["email"] = strings.ToUpper(d["email"].(string)) },
+		func(d map[string]interface{}) { d["phone"] = localPhone(d["phone"].(string)) },
+		func(d map[string]interface{}) { d["street"] = abbreviateStreet(d["street"].(string)) },
+		func(d map[string]interface{}) { d["dateOfBirth"] = germanDate(d["dateOfBirth"].(string)) },
+	}
+	c := copyData(data)
+	for _, i := range rnd.Perm(len(modifications))[:1+rnd.Intn(3)] {
+		modifications[i](c)
+	}
+	return c
+}
+
+func pick(rnd *rand.Rand, values []string) string {
+	return values[rnd.Intn(len(values))]
+}
+
+// typo swaps two adjacent and different characters
+func typo(rnd *rand.Rand, s string) string {
+	r := []rune(s)
+	candidates := make([]int, 0, len(r))
+	for i := 0; i < len(r)-1; i++ {
+		if r[i] != r[i+1] {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return s
+	}
+	i := candidates[rnd.Intn(len(candidates))]
+	r[i], r[i+1] = r[i+1], r[i]
+	return string(r)
+}
+
+// localPhone converts "+44 7123 456789" into "07123456789"
+func localPhone(phone string) string {
+	return "0" + strings.ReplaceAll(strings.TrimPrefix(phone, "+44 "), " ", "")
+}
+
+func abbreviateStreet(street string) string {
+	for long, short := range streetAbbreviations {
+		if strings.HasSuffix(street, long) {
+			return strings.TrimSuffix(street, long) + short
+		}
+	}
+	return street
+}
+
+// germanDate converts "2006-01-02" into "02.01.2006"
+func germanDate(date string) string {
+	parts := strings.Split(date, "-")
+	if len(parts) != 3 {
+		return date
+	}
+	return fmt.Sprintf("%v.%v.%v", parts[2], parts[1], parts[0])
+}
@@ -0,0 +1,53 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the graph in the Graphviz DOT format
+//
+// Each entity is drawn as a cluster, duplicates are highlighted.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "graph entities {")
+	fmt.Fprintln(bw, "  node [shape=box];")
+
+	cluster := -1
+	for i, node := range g.Nodes {
+		if i == 0 || node.EntityID != g.Nodes[i-1].EntityID {
+			if cluster >= 0 {
+				fmt.Fprintln(bw, "  }")
+			}
+			cluster++
+			fmt.Fprintf(bw, "  subgraph cluster_%v {\n", cluster)
+			fmt.Fprintf(bw, "    label=%v;\n", quote("entity "+node.EntityID))
+		}
+		if node.DuplicateOf != "" {
+			fmt.Fprintf(bw, "    %v [label=%v, style=filled, fillcolor=orange];\n", quote(node.ID), quote(node.ID+"\n(duplicate of "+node.DuplicateOf+")"))
+		} else {
+			fmt.Fprintf(bw, "    %v;\n", quote(node.ID))
+		}
+	}
+	if cluster >= 0 {
+		fmt.Fprintln(bw, "  }")
+	}
+
+	for _, link := range g.Links {
+		if link.Type == LinkTypeDuplicate {
+			fmt.Fprintf(bw, "  %v -- %v [style=dashed, color=orange, label=duplicate];\n", quote(link.Source), quote(link.Target))
+		} else {
+			fmt.Fprintf(bw, "  %v -- %v [label=%v];\n", quote(link.Source), quote(link.Target), quote(link.Label))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,144 @@
+// Package graph exports entities as graphs, where records are nodes and edges
+// as well as duplicates are links between them.
+//
+// Supported formats are Graphviz DOT, GraphML and a JSON format with nodes and
+// links, as used by many JavaScript visualisation libraries.
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	api "github.com/tilotech/tilores-plugin-api"
+)
+
+// supported formats
+const (
+	FormatDOT     = "dot"
+	FormatGraphML = "graphml"
+	FormatJSON    = "json"
+)
+
+// link types
+const (
+	LinkTypeEdge      = "edge"
+	LinkTypeDuplicate = "duplicate"
+)
+
+// Graph is the format independent representation of one or more entities
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Links []Link `json:"links"`
+}
+
+// Node represents a single record
+type Node struct {
+	ID          string                 `json:"id"`
+	EntityID    string                 `json:"entityID"`
+	DuplicateOf string                 `json:"duplicateOf,omitempty"`
+	Data        map[string]interface{} `json:"data"`
+}
+
+// Link represents either an edge or a duplicate relation between two records
+//
+// For edges, the label is the rule ID. For duplicates, the source is the
+// original record and the target the duplicate.
+type Link struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+	Label  string `json:"label,omitempty"`
+}
+
+// New creates the graph for the given entities
+//
+// Edges that do not reference records of the same entity are ignored.
+func New(entities []*api.Entity) *Graph {
+	g := &Graph{
+		Nodes: []Node{},
+		Links: []Link{},
+	}
+	for _, entity := range entities {
+		recordIDs := make(map[string]bool, len(entity.Records))
+		for _, record := range entity.Records {
+			recordIDs[record.ID] = true
+		}
+		duplicateOf := map[string]string{}
+		originals := make([]string, 0, len(entity.Duplicates))
+		for original, duplicates := range entity.Duplicates {
+			originals = append(originals, original)
+			for _, duplicate := range duplicates {
+				duplicateOf[duplicate] = original
+			}
+		}
+		sort.Strings(originals)
+
+		for _, record := range entity.Records {
+			g.Nodes = append(g.Nodes, Node{
+				ID:          record.ID,
+				EntityID:    entity.ID,
+				DuplicateOf: duplicateOf[record.ID],
+				Data:        record.Data,
+			})
+		}
+		for _, edge := range entity.Edges {
+			a, b, ruleID, ok := parseEdge(edge, recordIDs)
+			if ok {
+				g.Links = append(g.Links, Link{Source: a, Target: b, Type: LinkTypeEdge, Label: ruleID})
+			}
+		}
+		for _, original := range originals {
+			for _, duplicate := range entity.Duplicates[original] {
+				g.Links = append(g.Links, Link{Source: original, Target: duplicate, Type: LinkTypeDuplicate})
+			}
+		}
+	}
+	return g
+}
+
+// parseEdge splits an edge like "recordID:anotherRecordID:RULEID"
+//
+// Since record IDs may contain colons, the record IDs are resolved using the
+// known record IDs.
+func parseEdge(edge string, recordIDs map[string]bool) (string, string, string, bool) {
+	i := strings.LastIndex(edge, ":")
+	if i < 0 {
+		return "", "", "", false
+	}
+	pair, ruleID := edge[:i], edge[i+1:]
+	for j := strings.Index(pair, ":"); j >= 0; {
+		a, b := pair[:j], pair[j+1:]
+		if recordIDs[a] && recordIDs[b] {
+			return a, b, ruleID, true
+		}
+		next := strings.Index(pair[j+1:], ":")
+		if next < 0 {
+			break
+		}
+		j += next + 1
+	}
+	return "", "", "", false
+}
+
+// Write writes the graph in the given format
+func (g *Graph) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatDOT:
+		return g.WriteDOT(w)
+	case FormatGraphML:
+		return g.WriteGraphML(w)
+	case FormatJSON:
+		return g.WriteJSON(w)
+	}
+	return fmt.Errorf("unsupported graph format %v, must be one of %v, %v or %v", format, FormatDOT, FormatGraphML, FormatJSON)
+}
+
+// WriteJSON writes the graph as a JSON object with nodes and links
+func (g *Graph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(g)
+}
@@ -0,0 +1,116 @@
+package graph
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+)
+
+func TestNew(t *testing.T) {
+	actual := New(testEntities())
+
+	assert.Equal(t, []Node{
+		{ID: "a:1", EntityID: "e1", Data: map[string]interface{}{"name": "Anna"}},
+		{ID: "b", EntityID: "e1", DuplicateOf: "a:1", Data: map[string]interface{}{"name": "Anna"}},
+		{ID: "c", EntityID: "e1", Data: map[string]interface{}{"name": "Ann \"A\""}},
+		{ID: "d", EntityID: "e2", Data: map[string]interface{}{"name": "John"}},
+	}, actual.Nodes)
+	assert.Equal(t, []Link{
+		{Source: "a:1", Target: "b", Type: LinkTypeEdge, Label: "R1"},
+		{Source: "a:1", Target: "c", Type: LinkTypeEdge, Label: "R2"},
+		{Source: "a:1", Target: "b", Type: LinkTypeDuplicate},
+	}, actual.Links)
+}
+
+func TestWriteDOT(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := New(testEntities()).Write(buf, FormatDOT)
+	assert.NoError(t, err)
+	assert.Equal(t, `graph entities {
+  node [shape=box];
+  subgraph cluster_0 {
+    label="entity e1";
+    "a:1";
+    "b" [label="b\n(duplicate of a:1)", style=filled, fillcolor=orange];
+    "c";
+  }
+  subgraph cluster_1 {
+    label="entity e2";
+    "d";
+  }
+  "a:1" -- "b" [label="R1"];
+  "a:1" -- "c" [label="R2"];
+  "a:1" -- "b" [style=dashed, color=orange, label=duplicate];
+}
+`, buf.String())
+}
+
+func TestWriteGraphML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := New(testEntities()[1:]).Write(buf, FormatGraphML)
+	assert.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="entityID" for="node" attr.name="entityID" attr.type="string"></key>
+  <key id="duplicateOf" for="node" attr.name="duplicateOf" attr.type="string"></key>
+  <key id="data" for="node" attr.name="data" attr.type="string"></key>
+  <key id="type" for="edge" attr.name="type" attr.type="string"></key>
+  <key id="label" for="edge" attr.name="label" attr.type="string"></key>
+  <graph id="entities" edgedefault="undirected">
+    <node id="d">
+      <data key="entityID">e2</data>
+      <data key="data">{&#34;name&#34;:&#34;John&#34;}</data>
+    </node>
+  </graph>
+</graphml>
+`, buf.String())
+
+	buf.Reset()
+	err = New(testEntities()).Write(buf, FormatGraphML)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `<data key="duplicateOf">a:1</data>`)
+	assert.Contains(t, buf.String(), `<edge source="a:1" target="c">
+      <data key="type">edge</data>
+      <data key="label">R2</data>
+    </edge>`)
+}
+
+func TestWriteJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := New(testEntities()[1:]).Write(buf, FormatJSON)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"nodes": [{"id": "d", "entityID": "e2", "data": {"name": "John"}}],
+		"links": []
+	}`, buf.String())
+}
+
+func TestWriteUnsupportedFormat(t *testing.T) {
+	err := New(testEntities()).Write(&bytes.Buffer{}, "png")
+	assert.EqualError(t, err, "unsupported graph format png, must be one of dot, graphml or json")
+}
+
+func testEntities() []*api.Entity {
+	return []*api.Entity{
+		{
+			ID: "e1",
+			Records: []*api.Record{
+				{ID: "a:1", Data: map[string]interface{}{"name": "Anna"}},
+				{ID: "b", Data: map[string]interface{}{"name": "Anna"}},
+				{ID: "c", Data: map[string]interface{}{"name": "Ann \"A\""}},
+			},
+			Edges:      api.Edges{"a:1:b:R1", "a:1:c:R2", "a:1:unknown:R3"},
+			Duplicates: api.Duplicates{"a:1": {"b"}},
+		},
+		{
+			ID: "e2",
+			Records: []*api.Record{
+				{ID: "d", Data: map[string]interface{}{"name": "John"}},
+			},
+			Edges:      api.Edges{},
+			Duplicates: api.Duplicates{},
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package graph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+)
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph in the GraphML format
+//
+// Nodes contain the entity ID, the original record ID for duplicates and the
+// record data as JSON. Links contain their type and label.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "entityID", For: "node", AttrName: "entityID", AttrType: "string"},
+			{ID: "duplicateOf", For: "node", AttrName: "duplicateOf", AttrType: "string"},
+			{ID: "data", For: "node", AttrName: "data", AttrType: "string"},
+			{ID: "type", For: "edge", AttrName: "type", AttrType: "string"},
+			{ID: "label", For: "edge", AttrName: "label", AttrType: "string"},
+		},
+		Graph: graphMLGraph{
+			ID:          "entities",
+			EdgeDefault: "undirected",
+			Nodes:       make([]graphMLNode, 0, len(g.Nodes)),
+			Edges:       make([]graphMLEdge, 0, len(g.Links)),
+		},
+	}
+	for _, node := range g.Nodes {
+		data, err := json.Marshal(node.Data)
+		if err != nil {
+			return err
+		}
+		n := graphMLNode{
+			ID: node.ID,
+			Data: []graphMLData{
+				{Key: "entityID", Value: node.EntityID},
+				{Key: "data", Value: string(data)},
+			},
+		}
+		if node.DuplicateOf != "" {
+			n.Data = append(n.Data, graphMLData{Key: "duplicateOf", Value: node.DuplicateOf})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, n)
+	}
+	for _, link := range g.Links {
+		e := graphMLEdge{
+			Source: link.Source,
+			Target: link.Target,
+			Data:   []graphMLData{{Key: "type", Value: link.Type}},
+		}
+		if link.Label != "" {
+			e.Data = append(e.Data, graphMLData{Key: "label", Value: link.Label})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, e)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,266 @@
+package pkg
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// RecordVersion is a record as it was stored during a period of time
+type RecordVersion struct {
+	Record *api.Record `json:"record"`
+	From   time.Time   `json:"from"`
+	To     *time.Time  `json:"to"` // nil while the record is still stored
+}
+
+// Membership defines to which entity a record belonged during a period of time
+type Membership struct {
+	EntityID string     `json:"entityID"`
+	From     time.Time  `json:"from"`
+	To       *time.Time `json:"to"` // nil while the record still belongs to the entity
+}
+
+// EntityAtInput includes the data required to get an entity at a point in time
+type EntityAtInput struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// RecordHistoryInput includes the data required to get the history of a record
+type RecordHistoryInput struct {
+	ID string `json:"id"`
+}
+
+// RecordHistoryOutput contains all versions of a record and the entities it
+// belonged to, both ordered from oldest to newest
+type RecordHistoryOutput struct {
+	Versions    []RecordVersion `json:"versions"`
+	Memberships []Membership    `json:"memberships"`
+}
+
+// history keeps the versions of records and their entity membership
+//
+// The versions of removed records are kept until more than capacity of them
+// exist. Then the oldest removed version is forgotten together with the
+// memberships of its record that ended before the oldest remaining version.
+type history struct {
+	capacity    int
+	versions    map[string][]*RecordVersion // record id -> versions
+	memberships map[string][]*Membership    // record id -> memberships
+	current     map[string]*Membership      // record id -> open membership
+	closed      []*RecordVersion            // removed versions, oldest first
+	seq         map[*RecordVersion]int
+	nextSeq     int
+}
+
+func newHistory(capacity int) *history {
+	return &history{
+		capacity:    capacity,
+		versions:    map[string][]*RecordVersion{},
+		memberships: map[string][]*Membership{},
+		current:     map[string]*Membership{},
+		seq:         map[*RecordVersion]int{},
+	}
+}
+
+func (h *history) added(t time.Time, record *api.Record) {
+	version := &RecordVersion{
+		Record: record,
+		From:   t,
+	}
+	h.versions[record.ID] = append(h.versions[record.ID], version)
+	h.seq[version] = h.nextSeq
+	h.nextSeq++
+}
+
+func (h *history) removed(t time.Time, record *api.Record) {
+	for _, version := range h.versions[record.ID] {
+		if version.Record == record && version.To == nil {
+			version.To = &t
+			h.closed = append(h.closed, version)
+		}
+	}
+	for len(h.closed) > h.capacity {
+		h.drop(h.closed[0])
+		h.closed = h.closed[1:]
+	}
+}
+
+// drop forgets the removed version and all memberships of its record that
+// ended before the oldest remaining version of the record
+func (h *history) drop(version *RecordVersion) {
+	recordID := version.Record.ID
+	versions := make([]*RecordVersion, 0, len(h.versions[recordID]))
+	for _, v := range h.versions[recordID] {
+		if v != version {
+			versions = append(versions, v)
+		}
+	}
+	delete(h.seq, version)
+
+	memberships := make([]*Membership, 0, len(h.memberships[recordID]))
+	for _, membership := range h.memberships[recordID] {
+		if membership.To == nil || len(versions) != 0 && membership.To.After(versions[0].From) {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	if len(versions) == 0 {
+		delete(h.versions, recordID)
+	} else {
+		h.versions[recordID] = versions
+	}
+	if len(memberships) == 0 {
+		delete(h.memberships, recordID)
+	} else {
+		h.memberships[recordID] = memberships
+	}
+}
+
+// updateMemberships closes the open memberships of the given records that
+// changed their entity or no longer exist and opens memberships for those
+// without one
+func (h *history) updateMemberships(t time.Time, entityIDs map[string]string, recordIDs []string) {
+	for _, recordID := range recordIDs {
+		entityID, exists := entityIDs[recordID]
+		if membership, ok := h.current[recordID]; ok {
+			if exists && membership.EntityID == entityID {
+				continue
+			}
+			membership.To = &t
+			delete(h.current, recordID)
+		}
+		if !exists {
+			continue
+		}
+		membership := &Membership{
+			EntityID: entityID,
+			From:     t,
+		}
+		h.memberships[recordID] = append(h.memberships[recordID], membership)
+		h.current[recordID] = membership
+	}
+}
+
+// forget removes all versions and memberships of the record
+func (h *history) forget(recordID string) {
+	for _, version := range h.versions[recordID] {
+		delete(h.seq, version)
+	}
+	closed := h.closed[:0]
+	for _, version := range h.closed {
+		if version.Record.ID != recordID {
+			closed = append(closed, version)
+		}
+	}
+	h.closed = closed
+	delete(h.versions, recordID)
+	delete(h.memberships, recordID)
+	delete(h.current, recordID)
+}
+
+// recordsAt returns all record versions that were valid at the given time in
+// the order they were added
+//
+// If entityID is not empty, only records that belonged to that entity are
+// returned.
+func (h *history) recordsAt(t time.Time, entityID string) []*api.Record {
+	versions := []*RecordVersion{}
+	for recordID, recordVersions := range h.versions {
+		if entityID != "" && !h.memberAt(t, recordID, entityID) {
+			continue
+		}
+		for _, version := range recordVersions {
+			if validAt(t, version.From, version.To) {
+				versions = append(versions, version)
+			}
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return h.seq[versions[i]] < h.seq[versions[j]]
+	})
+	records := make([]*api.Record, 0, len(versions))
+	for _, version := range versions {
+		records = append(records, version.Record)
+	}
+	return records
+}
+
+func (h *history) memberAt(t time.Time, recordID string, entityID string) bool {
+	for _, membership := range h.memberships[recordID] {
+		if membership.EntityID == entityID && validAt(t, membership.From, membership.To) {
+			return true
+		}
+	}
+	return false
+}
+
+func validAt(t time.Time, from time.Time, to *time.Time) bool {
+	return !t.Before(from) && (to == nil || t.Before(*to))
+}
+
+// EntityAt returns the entity with the given ID as it was at the given time
+//
+// Without rules, the entity contains all records that were stored at that
+// time. With rules, the entity is nil if it did not exist at that time. Edges
+// and duplicates are calculated using the current rules.
+func (f *FakeDispatcher) EntityAt(_ context.Context, input *EntityAtInput) (*dispatcher.EntityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.clustering() {
+		return &dispatcher.EntityOutput{
+			Entity: allRecordsEntity(input.ID, f.recordHistory().recordsAt(input.Time, "")),
+		}, nil
+	}
+	records := f.recordHistory().recordsAt(input.Time, input.ID)
+	if len(records) == 0 {
+		return &dispatcher.EntityOutput{}, nil
+	}
+	store := f.entityStore()
+	return &dispatcher.EntityOutput{
+		Entity: buildEntity(input.ID, records, store.matchingRules),
+	}, nil
+}
+
+// RecordHistory returns all versions of the record with the given ID and the
+// entities it belonged to
+func (f *FakeDispatcher) RecordHistory(_ context.Context, input *RecordHistoryInput) (*RecordHistoryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h := f.recordHistory()
+	output := &RecordHistoryOutput{
+		Versions:    make([]RecordVersion, 0, len(h.versions[input.ID])),
+		Memberships: make([]Membership, 0, len(h.memberships[input.ID])),
+	}
+	for _, version := range h.versions[input.ID] {
+		output.Versions = append(output.Versions, *version)
+	}
+	for _, membership := range h.memberships[input.ID] {
+		output.Memberships = append(output.Memberships, *membership)
+	}
+	return output, nil
+}
+
+func (f *FakeDispatcher) recordHistory() *history {
+	if f.history == nil {
+		f.history = newHistory(f.historyCapacity())
+	}
+	return f.history
+}
+
+func (f *FakeDispatcher) historyCapacity() int {
+	if f.HistoryCapacity <= 0 {
+		return f.capacity()
+	}
+	return f.HistoryCapacity
+}
+
+func (f *FakeDispatcher) currentTime() time.Time {
+	if f.now == nil {
+		return time.Now()
+	}
+	return f.now()
+}
@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestEntityAt(t *testing.T) {
+	clock := &testClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fixture := &FakeDispatcher{Rules: testRules, Capacity: 3, now: clock.Now}
+	ctx := context.Background()
+
+	t1 := clock.tick()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	entityID := fixture.Entities()[0].ID
+
+	t2 := clock.tick()
+	_, err = fixture.Submit(ctx, createSubmitInput(person("C", "Ann", "Smith", "smith@example.com")))
+	assert.NoError(t, err)
+
+	t3 := clock.tick()
+	_, err = fixture.Submit(ctx, createSubmitInput(person("B", "Ann", "Smith", "b@example.com")))
+	assert.NoError(t, err)
+
+	t4 := clock.tick()
+	_, err = fixture.Submit(ctx, createSubmitInput(person("D", "John", "Doe", "john@example.com")))
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		time          time.Time
+		expectedIDs   []string
+		expectedEdges []string
+	}{
+		"before":        {time: t1.Add(-time.Second)},
+		"first submit":  {time: t1, expectedIDs: []string{"A", "B"}, expectedEdges: []string{"A:B:R2"}},
+		"second submit": {time: t2.Add(time.Millisecond), expectedIDs: []string{"A", "B", "C"}, expectedEdges: []string{"A:B:R2", "B:C:R1"}},
+		"update of B":   {time: t3, expectedIDs: []string{"C", "B"}, expectedEdges: []string{"C:B:R1"}},
+		"eviction of A": {time: t4, expectedIDs: []string{"C", "B"}, expectedEdges: []string{"C:B:R1"}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := fixture.EntityAt(ctx, &EntityAtInput{ID: entityID, Time: c.time})
+			assert.NoError(t, err)
+			if c.expectedIDs == nil {
+				assert.Nil(t, actual.Entity)
+				return
+			}
+			assert.Equal(t, entityID, actual.Entity.ID)
+			assert.Equal(t, c.expectedIDs, ids(actual.Entity.Records))
+			assert.ElementsMatch(t, c.expectedEdges, actual.Entity.Edges)
+		})
+	}
+
+	current, err := fixture.Entity(ctx, &dispatcher.EntityInput{ID: fixture.Entities()[1].ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"D"}, ids(current.Entity.Records))
+	actual, err := fixture.EntityAt(ctx, &EntityAtInput{ID: current.Entity.ID, Time: t4})
+	assert.NoError(t, err)
+	assert.Equal(t, current, actual)
+}
+
+func TestRecordHistory(t *testing.T) {
+	clock := &testClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fixture := &FakeDispatcher{Rules: testRules, now: clock.Now}
+	ctx := context.Background()
+
+	t1 := clock.tick()
+	_, err := fixture.Submit(ctx, createSubmitInput(person("A", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err)
+	e1 := fixture.Entities()[0].ID
+
+	t2 := clock.tick()
+	_, err = fixture.Submit(ctx, createSubmitInput(person("B", "Anna", "Smith", "b@example.com")))
+	assert.NoError(t, err)
+
+	t3 := clock.tick()
+	updated := person("A", "Anna", "Miller", "anna@example.com")
+	_, err = fixture.Submit(ctx, createSubmitInput(updated))
+	assert.NoError(t, err)
+	e2 := fixture.Entities()[1].ID
+
+	actual, err := fixture.RecordHistory(ctx, &RecordHistoryInput{ID: "A"})
+	assert.NoError(t, err)
+	assert.Equal(t, &RecordHistoryOutput{
+		Versions: []RecordVersion{
+			{Record: person("A", "Anna", "Smith", "anna@example.com"), From: t1, To: &t3},
+			{Record: updated, From: t3},
+		},
+		Memberships: []Membership{
+			{EntityID: e1, From: t1, To: &t3},
+			{EntityID: e2, From: t3},
+		},
+	}, actual)
+
+	actual, err = fixture.RecordHistory(ctx, &RecordHistoryInput{ID: "B"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Membership{
+		{EntityID: e1, From: t2},
+	}, actual.Memberships)
+
+	actual, err = fixture.RecordHistory(ctx, &RecordHistoryInput{ID: "unknown"})
+	assert.NoError(t, err)
+	assert.Empty(t, actual.Versions)
+	assert.Empty(t, actual.Memberships)
+}
+
+func TestHistoryCapacity(t *testing.T) {
+	clock := &testClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fixture := &FakeDispatcher{Rules: testRules, Capacity: 2, HistoryCapacity: 1, now: clock.Now}
+	ctx := context.Background()
+
+	t1 := clock.tick()
+	_, err := fixture.Submit(ctx, createSubmitInput(person("A", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err)
+	entityID := fixture.Entities()[0].ID
+	t2 := clock.tick()
+	updated := person("A", "Anna", "Miller", "anna@example.com")
+	_, err = fixture.Submit(ctx, createSubmitInput(updated))
+	assert.NoError(t, err)
+	t3 := clock.tick()
+	_, err = fixture.Submit(ctx, createSubmitInput(person("B", "John", "Doe", "john@example.com")))
+	assert.NoError(t, err)
+	t4 := clock.tick()
+	_, err = fixture.Submit(ctx, createSubmitInput(person("C", "Jane", "Roe", "jane@example.com")))
+	assert.NoError(t, err)
+
+	actual, err := fixture.RecordHistory(ctx, &RecordHistoryInput{ID: "A"})
+	assert.NoError(t, err)
+	assert.Equal(t, &RecordHistoryOutput{
+		Versions:    []RecordVersion{{Record: updated, From: t2, To: &t4}},
+		Memberships: []Membership{{EntityID: entityID, From: t1, To: &t4}},
+	}, actual, "the oldest removed version must be forgotten")
+	entity, err := fixture.EntityAt(ctx, &EntityAtInput{ID: entityID, Time: t1})
+	assert.NoError(t, err)
+	assert.Nil(t, entity.Entity)
+
+	t5 := clock.tick()
+	_, err = fixture.Submit(ctx, createSubmitInput(person("D", "Max", "Muster", "max@example.com")))
+	assert.NoError(t, err)
+
+	actual, err = fixture.RecordHistory(ctx, &RecordHistoryInput{ID: "A"})
+	assert.NoError(t, err)
+	assert.Empty(t, actual.Versions)
+	assert.Empty(t, actual.Memberships)
+	actual, err = fixture.RecordHistory(ctx, &RecordHistoryInput{ID: "B"})
+	assert.NoError(t, err)
+	if assert.Len(t, actual.Versions, 1) {
+		assert.Equal(t, &t5, actual.Versions[0].To)
+	}
+	assert.Equal(t, t3, actual.Memberships[0].From)
+	assert.Len(t, fixture.recordHistory().closed, 1)
+}
+
+func TestEntityAtWithoutRules(t *testing.T) {
+	clock := &testClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fixture := &FakeDispatcher{Capacity: 2, now: clock.Now}
+	ctx := context.Background()
+
+	t1 := clock.tick()
+	_, err := fixture.Submit(ctx, createSubmitInput(record("1"), record("2")))
+	assert.NoError(t, err)
+	t2 := clock.tick()
+	_, err = fixture.Submit(ctx, createSubmitInput(record("3")))
+	assert.NoError(t, err)
+
+	actual, err := fixture.EntityAt(ctx, &EntityAtInput{ID: "foo-id", Time: t1})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo-id", actual.Entity.ID)
+	assert.Equal(t, []string{"1", "2"}, ids(actual.Entity.Records))
+
+	actual, err = fixture.EntityAt(ctx, &EntityAtInput{ID: "foo-id", Time: t2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3"}, ids(actual.Entity.Records))
+}
+
+func TestHistoryViaAdmin(t *testing.T) {
+	p, err := StartInProcess(&FakeDispatcher{Rules: testRules})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+	ctx := context.Background()
+	_, err = p.Dispatcher.Submit(ctx, createSubmitInput(person("A", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err)
+	entityID := p.Fake.Entities()[0].ID
+
+	entity, err := p.Admin.EntityAt(ctx, &EntityAtInput{ID: entityID, Time: time.Now()})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A"}, ids(entity.Entity.Records))
+
+	history, err := p.Admin.RecordHistory(ctx, &RecordHistoryInput{ID: "A"})
+	assert.NoError(t, err)
+	if assert.Len(t, history.Versions, 1) {
+		assert.Nil(t, history.Versions[0].To)
+	}
+}
+
+// testClock returns the same time until it is advanced
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// tick advances the clock by one minute and returns the new time
+func (c *testClock) tick() time.Time {
+	c.now = c.now.Add(time.Minute)
+	return c.now
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tilotech/go-plugin"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// InProcessPlugin is a FakeDispatcher that is served as a plugin from within
+// the current process
+//
+// All calls on Dispatcher and Admin pass the same JSON and unix socket layer as
+// calls to the plugin binary, while Fake provides direct access to the
+// underlying state.
+type InProcessPlugin struct {
+	Dispatcher dispatcher.Dispatcher
+	Admin      *Admin
+	Fake       *FakeDispatcher
+
+	term   plugin.TermFunc
+	dir    string
+	stdout *os.File
+}
+
+// startMu serializes starting plugins, because starting modifies process wide
+// state, like environment variables and os.Stdout
+var startMu sync.Mutex
+
+// StartInProcess starts the given FakeDispatcher as a plugin on a temporary
+// socket using plugin.StartWithProvider
+//
+// If fake is nil, a new FakeDispatcher will be used.
+//
+// The returned plugin MUST be closed after usage.
+func StartInProcess(fake *FakeDispatcher) (*InProcessPlugin, error) {
+	if fake == nil {
+		fake = &FakeDispatcher{}
+	}
+
+	startMu.Lock()
+	defer startMu.Unlock()
+
+	dir, err := os.MkdirTemp("", "fake-dispatcher")
+	if err != nil {
+		return nil, err
+	}
+
+	// dispatcher.Connect always uses a socket inside the temp dir
+	originalTempDir, tempDirSet := os.LookupEnv("TMPDIR")
+	originalStdout := os.Stdout
+	err = os.Setenv("TMPDIR", dir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	d, term, err := dispatcher.Connect(plugin.StartWithProvider(Provide(fake, fake)), plugin.DefaultConfig())
+	if tempDirSet {
+		_ = os.Setenv("TMPDIR", originalTempDir)
+	} else {
+		_ = os.Unsetenv("TMPDIR")
+	}
+	if err != nil {
+		os.Stdout = originalStdout
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	admin, err := ConnectAdmin(filepath.Join(dir, "dispatcher"))
+	if err != nil {
+		_ = term()
+		os.Stdout = originalStdout
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &InProcessPlugin{
+		Dispatcher: d,
+		Admin:      admin,
+		Fake:       fake,
+		term:       term,
+		dir:        dir,
+		stdout:     originalStdout,
+	}, nil
+}
+
+// Close terminates the plugin, restores os.Stdout and removes the temporary
+// socket
+func (p *InProcessPlugin) Close() error {
+	err := p.term()
+	os.Stdout = p.stdout
+	removeErr := os.RemoveAll(p.dir)
+	if err != nil {
+		return err
+	}
+	return removeErr
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestStartInProcess(t *testing.T) {
+	ctx := context.Background()
+	originalStdout := os.Stdout
+
+	p, err := StartInProcess(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.FileExists(t, filepath.Join(p.dir, "dispatcher"))
+
+	submitOutput, err := p.Dispatcher.Submit(ctx, createSubmitInput(record("1"), record("2"), record("3")))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, submitOutput.RecordsAdded)
+
+	records := p.Fake.Records()
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, "1", records[0].ID)
+		assert.Equal(t, map[string]interface{}{"ignoredField": "match", "isOdd": true}, records[0].Data)
+	}
+
+	entityOutput, err := p.Dispatcher.Entity(ctx, &dispatcher.EntityInput{ID: "foo-id"})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo-id", entityOutput.Entity.ID)
+	assert.Len(t, entityOutput.Entity.Records, 3)
+
+	searchOutput, err := p.Dispatcher.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{"isOdd": true}})
+	assert.NoError(t, err)
+	if assert.Len(t, searchOutput.Entities, 1) {
+		assert.Len(t, searchOutput.Entities[0].Records, 2)
+	}
+
+	_, err = p.Dispatcher.Disassemble(ctx, &dispatcher.DisassembleInput{})
+	assert.EqualError(t, err, "no edges or records provided for disassemble")
+
+	assert.NoError(t, p.Close())
+	assert.Equal(t, originalStdout, os.Stdout)
+	assert.NoDirExists(t, p.dir)
+}
+
+func TestStartInProcessWithExistingFake(t *testing.T) {
+	fake := &FakeDispatcher{}
+	_, err := fake.Submit(context.Background(), createSubmitInput(record("1")))
+	assert.NoError(t, err)
+
+	p, err := StartInProcess(fake)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+
+	entityOutput, err := p.Dispatcher.Entity(context.Background(), &dispatcher.EntityInput{ID: "foo-id"})
+	assert.NoError(t, err)
+	if assert.Len(t, entityOutput.Entity.Records, 1) {
+		assert.Equal(t, "1", entityOutput.Entity.Records[0].ID)
+	}
+}
@@ -0,0 +1,313 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tilotech/go-plugin"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// Level defines the severity of a log entry
+type Level int
+
+// log levels, LevelOff disables logging
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelOff
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "off"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelOff {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level for one of debug, info, warn, error or off
+func ParseLevel(level string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(level, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %v, must be one of %v", level, strings.Join(levelNames, ", "))
+}
+
+// log formats
+const (
+	LogFormatJSON   = "json"
+	LogFormatLogfmt = "logfmt"
+)
+
+// Field is a single key value pair of a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger writes structured log entries as JSON or logfmt lines
+//
+// Logger is safe for concurrent use.
+type Logger struct {
+	w      io.Writer
+	level  Level
+	logfmt bool
+	mu     sync.Mutex
+	now    func() time.Time
+}
+
+// NewLogger returns a Logger that writes all entries with at least the given
+// level in the given format (json or logfmt) to w
+func NewLogger(w io.Writer, level Level, format string) (*Logger, error) {
+	if format != LogFormatJSON && format != LogFormatLogfmt {
+		return nil, fmt.Errorf("invalid log format %v, must be one of %v or %v", format, LogFormatJSON, LogFormatLogfmt)
+	}
+	return &Logger{
+		w:      w,
+		level:  level,
+		logfmt: format == LogFormatLogfmt,
+		now:    time.Now,
+	}, nil
+}
+
+// Enabled returns true if entries with the given level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level && level < LevelOff
+}
+
+// Log writes an entry with the time, level, message and the given fields
+//
+// Errors while writing are ignored.
+func (l *Logger) Log(level Level, msg string, fields ...Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields = append([]Field{
+		{Key: "time", Value: l.now().UTC().Format(time.RFC3339Nano)},
+		{Key: "level", Value: level.String()},
+		{Key: "msg", Value: msg},
+	}, fields...)
+
+	line := &bytes.Buffer{}
+	if l.logfmt {
+		writeLogfmt(line, fields)
+	} else {
+		writeJSON(line, fields)
+	}
+	line.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line.Bytes())
+}
+
+// Error logs the error with level error
+func (l *Logger) Error(err error, fields ...Field) {
+	l.Log(LevelError, err.Error(), fields...)
+}
+
+func writeJSON(buf *bytes.Buffer, fields []Field) {
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(field.Value))
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+}
+
+func writeLogfmt(buf *bytes.Buffer, fields []Field) {
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(field.Key)
+		buf.WriteByte('=')
+		value := ""
+		switch v := field.Value.(type) {
+		case string:
+			value = v
+		case json.RawMessage:
+			value = string(v)
+		default:
+			value = fmt.Sprint(v)
+		}
+		if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+}
+
+// CallLogger wraps a Dispatcher and logs every call with its duration, input
+// and output sizes and error
+//
+// Successful calls are logged with level info, failed calls with level error.
+// With level debug, the complete input is logged as well.
+type CallLogger struct {
+	dispatcher dispatcher.Dispatcher
+	logger     *Logger
+}
+
+// NewCallLogger returns a CallLogger that forwards all calls to the given
+// Dispatcher and logs them using the given Logger
+func NewCallLogger(d dispatcher.Dispatcher, logger *Logger) *CallLogger {
+	return &CallLogger{
+		dispatcher: d,
+		logger:     logger,
+	}
+}
+
+// Entity forwards and logs the Entity call
+func (c *CallLogger) Entity(ctx context.Context, input *dispatcher.EntityInput) (*dispatcher.EntityOutput, error) {
+	start := time.Now()
+	output, err := c.dispatcher.Entity(ctx, input)
+	fields := []Field{{Key: "entityID", Value: input.ID}}
+	if output != nil && output.Entity != nil {
+		fields = append(fields, Field{Key: "records", Value: len(output.Entity.Records)})
+	}
+	c.log(methodEntity, start, input, err, fields...)
+	return output, err
+}
+
+// Submit forwards and logs the Submit call
+func (c *CallLogger) Submit(ctx context.Context, input *dispatcher.SubmitInput) (*dispatcher.SubmitOutput, error) {
+	start := time.Now()
+	output, err := c.dispatcher.Submit(ctx, input)
+	fields := []Field{{Key: "records", Value: len(input.Records)}}
+	if output != nil {
+		fields = append(fields, Field{Key: "recordsAdded", Value: output.RecordsAdded})
+	}
+	c.log(methodSubmit, start, input, err, fields...)
+	return output, err
+}
+
+// Search forwards and logs the Search call
+func (c *CallLogger) Search(ctx context.Context, input *dispatcher.SearchInput) (*dispatcher.SearchOutput, error) {
+	start := time.Now()
+	output, err := c.dispatcher.Search(ctx, input)
+	parameters := 0
+	if input.Parameters != nil {
+		parameters = len(*input.Parameters)
+	}
+	fields := []Field{{Key: "parameters", Value: parameters}}
+	if output != nil {
+		records := 0
+		for _, entity := range output.Entities {
+			records += len(entity.Records)
+		}
+		fields = append(fields,
+			Field{Key: "entities", Value: len(output.Entities)},
+			Field{Key: "records", Value: records},
+		)
+	}
+	c.log(methodSearch, start, input, err, fields...)
+	return output, err
+}
+
+// Disassemble forwards and logs the Disassemble call
+func (c *CallLogger) Disassemble(ctx context.Context, input *dispatcher.DisassembleInput) (*dispatcher.DisassembleOutput, error) {
+	start := time.Now()
+	output, err := c.dispatcher.Disassemble(ctx, input)
+	fields := []Field{
+		{Key: "reference", Value: input.Reference},
+		{Key: "edges", Value: len(input.Edges)},
+		{Key: "recordIDs", Value: len(input.RecordIDs)},
+	}
+	if output != nil {
+		fields = append(fields,
+			Field{Key: "deletedEdges", Value: output.DeletedEdges},
+			Field{Key: "deletedRecords", Value: output.DeletedRecords},
+			Field{Key: "entities", Value: len(output.EntityIDs)},
+		)
+	}
+	c.log(methodDisassemble, start, input, err, fields...)
+	return output, err
+}
+
+// RemoveConnectionBan forwards and logs the RemoveConnectionBan call
+func (c *CallLogger) RemoveConnectionBan(ctx context.Context, input *dispatcher.RemoveConnectionBanInput) error {
+	start := time.Now()
+	err := c.dispatcher.RemoveConnectionBan(ctx, input)
+	c.log(methodRemoveConnectionBan, start, input, err,
+		Field{Key: "reference", Value: input.Reference},
+		Field{Key: "entityID", Value: input.EntityID},
+		Field{Key: "others", Value: len(input.Others)},
+	)
+	return err
+}
+
+// NewAdminCallLogger returns a plugin.Provider that forwards all calls to the
+// given provider and logs the calls of admin methods the same way as the
+// CallLogger logs dispatcher calls
+//
+// Dispatcher methods are not logged, since they are usually already logged by
+// a CallLogger.
+func NewAdminCallLogger(provider plugin.Provider, logger *Logger) plugin.Provider {
+	return &adminCallLogger{
+		provider: provider,
+		calls:    &CallLogger{logger: logger},
+	}
+}
+
+type adminCallLogger struct {
+	provider plugin.Provider
+	calls    *CallLogger
+}
+
+func (a *adminCallLogger) Provide(method string) (plugin.RequestParameter, plugin.InvokeFunc, error) {
+	params, invoke, err := a.provider.Provide(method)
+	if err != nil || !strings.HasPrefix(method, adminMethodPrefix) {
+		return params, invoke, err
+	}
+	return params, func(ctx context.Context, params plugin.RequestParameter) (interface{}, error) {
+		start := time.Now()
+		response, err := invoke(ctx, params)
+		a.calls.log(method, start, params, err)
+		return response, err
+	}, nil
+}
+
+func (c *CallLogger) log(method string, start time.Time, input interface{}, err error, fields ...Field) {
+	level := LevelInfo
+	if err != nil {
+		level = LevelError
+	}
+	if !c.logger.Enabled(level) {
+		return
+	}
+	fields = append([]Field{
+		{Key: "method", Value: method},
+		{Key: "durationMs", Value: float64(time.Since(start).Microseconds()) / 1000},
+	}, fields...)
+	if err != nil {
+		fields = append(fields, Field{Key: "error", Value: err.Error()})
+	}
+	if c.logger.Enabled(LevelDebug) {
+		if raw, marshalErr := json.Marshal(input); marshalErr == nil {
+			fields = append(fields, Field{Key: "input", Value: json.RawMessage(raw)})
+		}
+	}
+	c.logger.Log(level, "dispatcher call", fields...)
+}
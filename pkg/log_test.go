@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	assert.Equal(t, "warn", level.String())
+
+	_, err = ParseLevel("verbose")
+	assert.EqualError(t, err, "invalid log level verbose, must be one of debug, info, warn, error, off")
+}
+
+func TestLogger(t *testing.T) {
+	cases := map[string]struct {
+		format   string
+		expected string
+	}{
+		"json": {
+			format:   LogFormatJSON,
+			expected: `{"time":"2021-01-01T00:00:00Z","level":"info","msg":"hello","count":2,"name":"a b"}` + "\n",
+		},
+		"logfmt": {
+			format:   LogFormatLogfmt,
+			expected: `time=2021-01-01T00:00:00Z level=info msg=hello count=2 name="a b"` + "\n",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger, err := NewLogger(buf, LevelInfo, c.format)
+			if !assert.NoError(t, err) {
+				return
+			}
+			logger.now = func() time.Time { return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+			logger.Log(LevelDebug, "ignored")
+			logger.Log(LevelInfo, "hello", Field{Key: "count", Value: 2}, Field{Key: "name", Value: "a b"})
+			assert.Equal(t, c.expected, buf.String())
+		})
+	}
+
+	_, err := NewLogger(&bytes.Buffer{}, LevelInfo, "xml")
+	assert.EqualError(t, err, "invalid log format xml, must be one of json or logfmt")
+}
+
+func TestCallLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := NewLogger(buf, LevelInfo, LogFormatJSON)
+	if !assert.NoError(t, err) {
+		return
+	}
+	d := NewCallLogger(&FakeDispatcher{}, logger)
+	ctx := context.Background()
+
+	_, err = d.Submit(ctx, createSubmitInput(record("1"), record("2")))
+	assert.NoError(t, err)
+	_, err = d.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{"isOdd": true}})
+	assert.NoError(t, err)
+	_, err = d.Disassemble(ctx, &dispatcher.DisassembleInput{})
+	assert.Error(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+	entries := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		assert.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+		assert.Contains(t, entries[i], "durationMs")
+		assert.NotContains(t, entries[i], "input")
+	}
+	assert.Equal(t, "info", entries[0]["level"])
+	assert.Equal(t, "Submit", entries[0]["method"])
+	assert.Equal(t, 2.0, entries[0]["records"])
+	assert.Equal(t, 2.0, entries[0]["recordsAdded"])
+	assert.Equal(t, "Search", entries[1]["method"])
+	assert.Equal(t, 1.0, entries[1]["entities"])
+	assert.Equal(t, 1.0, entries[1]["records"])
+	assert.Equal(t, "error", entries[2]["level"])
+	assert.Equal(t, "no edges or records provided for disassemble", entries[2]["error"])
+}
+
+func TestCallLoggerDebug(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := NewLogger(buf, LevelDebug, LogFormatLogfmt)
+	if !assert.NoError(t, err) {
+		return
+	}
+	d := NewCallLogger(&FakeDispatcher{}, logger)
+
+	_, err = d.Entity(context.Background(), &dispatcher.EntityInput{ID: "some-id"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `method=Entity`)
+	assert.Contains(t, buf.String(), `input="{\"id\":\"some-id\"}"`)
+
+	buf.Reset()
+	logger.level = LevelOff
+	_, err = d.Disassemble(context.Background(), &dispatcher.DisassembleInput{})
+	assert.Error(t, err)
+	assert.Empty(t, buf.String())
+}
+
+func TestAdminCallLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := NewLogger(buf, LevelInfo, LogFormatJSON)
+	if !assert.NoError(t, err) {
+		return
+	}
+	fake := &FakeDispatcher{}
+	provider := NewAdminCallLogger(Provide(fake, fake), logger)
+	ctx := context.Background()
+
+	params, invoke, err := provider.Provide(adminReloadMethod)
+	if assert.NoError(t, err) {
+		params.(*ReloadInput).Rules = []Rule{{ID: "R1"}}
+		_, err = invoke(ctx, params)
+		assert.Error(t, err)
+	}
+	params, invoke, err = provider.Provide(adminAuditMethod)
+	if assert.NoError(t, err) {
+		_, err = invoke(ctx, params)
+		assert.NoError(t, err)
+	}
+	params, invoke, err = provider.Provide("/entity")
+	if assert.NoError(t, err) {
+		_, err = invoke(ctx, params)
+		assert.NoError(t, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(t, lines, 2, "only admin methods must be logged") {
+		return
+	}
+	entries := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		assert.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+		assert.Contains(t, entries[i], "durationMs")
+	}
+	assert.Equal(t, "error", entries[0]["level"])
+	assert.Equal(t, adminReloadMethod, entries[0]["method"])
+	assert.Equal(t, "invalid rules: rule R1 has no fields", entries[0]["error"])
+	assert.Equal(t, "info", entries[1]["level"])
+	assert.Equal(t, adminAuditMethod, entries[1]["method"])
+}
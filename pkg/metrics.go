@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the call duration histogram buckets
+// in seconds
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// MetricsInput includes the data required to get the metrics
+type MetricsInput struct{}
+
+// MetricsOutput contains the metrics in the Prometheus text format
+type MetricsOutput struct {
+	Text string `json:"text"`
+}
+
+// metrics collects the calls of each dispatcher method
+type metrics struct {
+	mu        sync.Mutex
+	calls     map[string]int64
+	errors    map[string]int64
+	durations map[string]*histogram
+}
+
+// histogram counts observations per bucket, where each observation is only
+// counted in its smallest bucket
+type histogram struct {
+	counts []int64 // one per bucket plus +Inf
+	sum    float64
+	count  int64
+}
+
+func (m *metrics) observe(method string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = map[string]int64{}
+		m.errors = map[string]int64{}
+		m.durations = map[string]*histogram{}
+	}
+	m.calls[method]++
+	if err != nil {
+		m.errors[method]++
+	}
+	h, ok := m.durations[method]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(latencyBuckets)+1)}
+		m.durations[method] = h
+	}
+	seconds := duration.Seconds()
+	h.counts[sort.SearchFloat64s(latencyBuckets, seconds)]++
+	h.sum += seconds
+	h.count++
+}
+
+func (m *metrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	methods := make([]string, 0, len(m.calls))
+	for method := range m.calls {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	b := &strings.Builder{}
+	writeHeader(b, "fake_dispatcher_calls_total", "counter", "Number of dispatcher calls per method.")
+	for _, method := range methods {
+		fmt.Fprintf(b, "fake_dispatcher_calls_total{method=%q} %v\n", method, m.calls[method])
+	}
+	writeHeader(b, "fake_dispatcher_errors_total", "counter", "Number of failed dispatcher calls per method.")
+	for _, method := range methods {
+		fmt.Fprintf(b, "fake_dispatcher_errors_total{method=%q} %v\n", method, m.errors[method])
+	}
+	writeHeader(b, "fake_dispatcher_call_duration_seconds", "histogram", "Duration of dispatcher calls per method.")
+	for _, method := range methods {
+		h := m.durations[method]
+		cumulative := int64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(b, "fake_dispatcher_call_duration_seconds_bucket{method=%q,le=%q} %v\n", method, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(b, "fake_dispatcher_call_duration_seconds_bucket{method=%q,le=\"+Inf\"} %v\n", method, h.count)
+		fmt.Fprintf(b, "fake_dispatcher_call_duration_seconds_sum{method=%q} %v\n", method, formatFloat(h.sum))
+		fmt.Fprintf(b, "fake_dispatcher_call_duration_seconds_count{method=%q} %v\n", method, h.count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, metricType)
+}
+
+func writeGauge(b *strings.Builder, name, help string, value int) {
+	writeHeader(b, name, "gauge", help)
+	fmt.Fprintf(b, "%v %v\n", name, value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Metrics returns the call metrics as well as the current number of records,
+// entities, edges and connection bans in the Prometheus text format
+func (f *FakeDispatcher) Metrics(_ context.Context, _ *MetricsInput) (*MetricsOutput, error) {
+	b := &strings.Builder{}
+	err := f.metrics.write(b)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	records, entities, edges, bans := f.length, 0, 0, 0
+	if f.clustering() {
+		store := f.entityStore()
+		entities = len(store.entities)
+		for _, links := range store.links {
+			for _, ruleIDs := range links {
+				edges += len(ruleIDs)
+			}
+		}
+		edges /= 2 // links are stored in both directions
+		bans = len(store.bans)
+	} else if records != 0 {
+		entities = 1
+	}
+	f.mu.Unlock()
+
+	writeGauge(b, "fake_dispatcher_records", "Number of stored records.", records)
+	writeGauge(b, "fake_dispatcher_entities", "Number of entities.", entities)
+	writeGauge(b, "fake_dispatcher_edges", "Number of edges between records.", edges)
+	writeGauge(b, "fake_dispatcher_connection_bans", "Number of connection bans.", bans)
+	return &MetricsOutput{
+		Text: b.String(),
+	}, nil
+}
+
+// observe records the call of the given method in the metrics, it is meant
+// to be deferred with a pointer to the named error result
+func (f *FakeDispatcher) observe(method string, start time.Time, err *error) {
+	f.metrics.observe(method, time.Since(start), *err)
+}
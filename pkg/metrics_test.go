@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestMetrics(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+		person("C", "John", "Doe", "john@example.com"),
+	))
+	assert.NoError(t, err)
+	_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{})
+	assert.Error(t, err)
+
+	output, err := fixture.Metrics(ctx, &MetricsInput{})
+	assert.NoError(t, err)
+	assert.Contains(t, output.Text, "# TYPE fake_dispatcher_calls_total counter\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_calls_total{method=\"Disassemble\"} 1\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_calls_total{method=\"Submit\"} 1\n")
+	assert.NotContains(t, output.Text, "fake_dispatcher_calls_total{method=\"Search\"}")
+	assert.Contains(t, output.Text, "fake_dispatcher_errors_total{method=\"Disassemble\"} 1\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_errors_total{method=\"Submit\"} 0\n")
+	assert.Contains(t, output.Text, "# TYPE fake_dispatcher_call_duration_seconds histogram\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_call_duration_seconds_bucket{method=\"Submit\",le=\"+Inf\"} 1\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_call_duration_seconds_count{method=\"Submit\"} 1\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_records 3\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_entities 2\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_edges 1\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_connection_bans 0\n")
+}
+
+func TestMetricsWithoutRules(t *testing.T) {
+	fixture := &FakeDispatcher{}
+	ctx := context.Background()
+
+	output, err := fixture.Metrics(ctx, &MetricsInput{})
+	assert.NoError(t, err)
+	assert.Contains(t, output.Text, "fake_dispatcher_entities 0\n")
+
+	_, err = fixture.Submit(ctx, createSubmitInput(person("A", "Anna", "Smith", "anna@example.com")))
+	assert.NoError(t, err)
+	output, err = fixture.Metrics(ctx, &MetricsInput{})
+	assert.NoError(t, err)
+	assert.Contains(t, output.Text, "fake_dispatcher_records 1\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_entities 1\n")
+	assert.Contains(t, output.Text, "fake_dispatcher_edges 0\n")
+}
+
+func TestHistogram(t *testing.T) {
+	m := &metrics{}
+	m.observe(methodSearch, 200*time.Microsecond, nil)
+	m.observe(methodSearch, 2*time.Millisecond, nil)
+	m.observe(methodSearch, 10*time.Second, nil)
+
+	h := m.durations[methodSearch]
+	assert.Equal(t, int64(3), h.count)
+	assert.Equal(t, int64(1), h.counts[1])               // le 0.0005
+	assert.Equal(t, int64(1), h.counts[3])               // le 0.005
+	assert.Equal(t, int64(1), h.counts[len(h.counts)-1]) // +Inf
+}
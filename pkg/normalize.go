@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+func newPhoneComparator(args []string) (comparator, error) {
+	countryCode := ""
+	switch len(args) {
+	case 0:
+	case 1:
+		countryCode = strings.TrimPrefix(args[0], "+")
+		if countryCode == "" || strings.TrimFunc(countryCode, isDigit) != "" {
+			return nil, fmt.Errorf("argument %v must be a country calling code", args[0])
+		}
+	default:
+		return nil, fmt.Errorf("at most one argument supported")
+	}
+	return normalizedComparator(func(phone string) string {
+		return normalizePhone(phone, countryCode)
+	}), nil
+}
+
+// normalizePhone returns the phone number in an E.164 like form
+//
+// All characters except digits and a leading plus are removed, an international
+// prefix 00 is replaced by a plus and the trunk prefix 0 of national numbers is
+// replaced by the country calling code, if any. A trunk prefix in parentheses
+// after the country calling code, e.g. +49 (0)30 1234567, is removed. Without
+// country calling code, national numbers are returned as digits only.
+func normalizePhone(phone string, countryCode string) string {
+	phone = strings.TrimSpace(phone)
+	digits := onlyDigits(phone)
+	switch {
+	case strings.HasPrefix(phone, "+"), strings.HasPrefix(digits, "00"):
+		digits = strings.TrimPrefix(onlyDigits(strings.Replace(phone, "(0)", "", 1)), "00")
+	case countryCode != "":
+		digits = countryCode + strings.TrimPrefix(digits, "0")
+	default:
+		return digits
+	}
+	if digits == "" {
+		return ""
+	}
+	return "+" + digits
+}
+
+// onlyDigits removes all characters except digits
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if isDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// streetAbbreviations maps common abbreviations to their full word
+var streetAbbreviations = map[string]string{
+	"st":     "street",
+	"str":    "strasse",
+	"straße": "strasse",
+	"rd":     "road",
+	"ave":    "avenue",
+	"av":     "avenue",
+	"blvd":   "boulevard",
+	"ln":     "lane",
+	"dr":     "drive",
+	"ct":     "court",
+	"pl":     "place",
+	"sq":     "square",
+	"hwy":    "highway",
+	"n":      "north",
+	"e":      "east",
+	"s":      "south",
+	"w":      "west",
+}
+
+func newAddressComparator(args []string) (comparator, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("no arguments supported")
+	}
+	return normalizedComparator(normalizeAddress), nil
+}
+
+// normalizeAddress returns the lower case words of the address with expanded
+// abbreviations, followed by the house numbers
+//
+// Compound German street names like "Hauptstr." are expanded as well.
+func normalizeAddress(address string) string {
+	tokens := strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words := make([]string, 0, len(tokens))
+	numbers := []string{}
+	for _, token := range tokens {
+		if unicode.IsDigit([]rune(token)[0]) {
+			numbers = append(numbers, token)
+			continue
+		}
+		if full, ok := streetAbbreviations[token]; ok {
+			token = full
+		} else if strings.HasSuffix(token, "str") {
+			token += "asse"
+		} else if strings.HasSuffix(token, "straße") {
+			token = strings.TrimSuffix(token, "straße") + "strasse"
+		}
+		words = append(words, token)
+	}
+	return strings.Join(append(words, numbers...), " ")
+}
+
+func newEmailComparator(args []string) (comparator, error) {
+	domains := make(map[string]bool, len(args))
+	for _, domain := range args {
+		if domain == "" {
+			return nil, fmt.Errorf("domains must not be empty")
+		}
+		domains[strings.ToLower(domain)] = true
+	}
+	return normalizedComparator(func(email string) string {
+		return normalizeEmail(email, domains)
+	}), nil
+}
+
+// normalizeEmail returns the lower case email address, where dots and plus
+// tags are removed from the local part for the given domains
+func normalizeEmail(email string, domains map[string]bool) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if domains[domain] {
+		if plus := strings.Index(local, "+"); plus >= 0 {
+			local = local[:plus]
+		}
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
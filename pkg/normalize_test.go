@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestComparePhone(t *testing.T) {
+	cases := map[string]struct {
+		spec     string
+		a        interface{}
+		b        interface{}
+		expected match
+	}{
+		"equal":                 {spec: "phone", a: "+49 30 1234567", b: "+49 30 1234567", expected: exactMatch},
+		"formatting":            {spec: "phone", a: "+49 30 1234567", b: "+49 (30) 123-45-67", expected: fuzzyMatch},
+		"international prefix":  {spec: "phone", a: "+49 30 1234567", b: "0049 30 1234567", expected: fuzzyMatch},
+		"national without code": {spec: "phone", a: "+49 30 1234567", b: "030 1234567", expected: noMatch},
+		"national with code":    {spec: "phone:49", a: "+49 30 1234567", b: "030 / 1234567", expected: fuzzyMatch},
+		"national with plus":    {spec: "phone:+49", a: "+49 30 1234567", b: "030 1234567", expected: fuzzyMatch},
+		"national numbers":      {spec: "phone", a: "030 1234567", b: "030-1234567", expected: fuzzyMatch},
+		"trunk prefix":          {spec: "phone", a: "+49 30 1234567", b: "+49 (0)30 1234567", expected: fuzzyMatch},
+		"trunk prefix national": {spec: "phone:49", a: "+49 (0)30 1234567", b: "030 1234567", expected: fuzzyMatch},
+		"trunk prefix 00":       {spec: "phone", a: "0049 (0) 30 1234567", b: "+49 30 1234567", expected: fuzzyMatch},
+		"other country":         {spec: "phone:49", a: "+43 30 1234567", b: "030 1234567", expected: noMatch},
+		"different number":      {spec: "phone", a: "+49 30 1234567", b: "+49 30 1234568", expected: noMatch},
+		"no digits":             {spec: "phone", a: "n/a", b: "unknown", expected: noMatch},
+		"not a string":          {spec: "phone", a: "1234567", b: 1234567.0, expected: noMatch},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, compare(c.spec, c.a, c.b))
+			assert.Equal(t, c.expected, compare(c.spec, c.b, c.a), "comparison must be symmetric")
+		})
+	}
+
+	_, err := parseComparator("phone:de")
+	assert.EqualError(t, err, "invalid comparator phone:de: argument de must be a country calling code")
+	_, err = parseComparator("phone:49,43")
+	assert.EqualError(t, err, "invalid comparator phone:49,43: at most one argument supported")
+}
+
+func TestCompareAddress(t *testing.T) {
+	cases := map[string]struct {
+		a        interface{}
+		b        interface{}
+		expected match
+	}{
+		"casing and punctuation": {a: "12 Main Street", b: "12, main street.", expected: fuzzyMatch},
+		"abbreviation":           {a: "12 Main Street", b: "12 Main St.", expected: fuzzyMatch},
+		"house number position":  {a: "12 Main Street", b: "Main St 12", expected: fuzzyMatch},
+		"direction":              {a: "12 N Main St", b: "12 North Main Street", expected: fuzzyMatch},
+		"German abbreviation":    {a: "Hauptstraße 5a", b: "Hauptstr. 5a", expected: fuzzyMatch},
+		"German separate words":  {a: "Berliner Str. 7", b: "berliner strasse 7", expected: fuzzyMatch},
+		"different house number": {a: "12 Main Street", b: "14 Main Street", expected: noMatch},
+		"different street":       {a: "12 Main Street", b: "12 Main Road", expected: noMatch},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, compare(CompareAddress, c.a, c.b))
+			assert.Equal(t, c.expected, compare(CompareAddress, c.b, c.a), "comparison must be symmetric")
+		})
+	}
+}
+
+func TestCompareEmail(t *testing.T) {
+	cases := map[string]struct {
+		spec     string
+		a        interface{}
+		b        interface{}
+		expected match
+	}{
+		"casing":                {spec: "email", a: "Anna.Smith@Example.com", b: "anna.smith@example.com", expected: fuzzyMatch},
+		"dots in other domain":  {spec: "email:gmail.com", a: "anna.smith@example.com", b: "annasmith@example.com", expected: noMatch},
+		"dots in domain":        {spec: "email:gmail.com", a: "anna.smith@gmail.com", b: "AnnaSmith@gmail.com", expected: fuzzyMatch},
+		"plus tag in domain":    {spec: "email:gmail.com", a: "anna.smith@gmail.com", b: "annasmith+news@gmail.com", expected: fuzzyMatch},
+		"plus tag other domain": {spec: "email:gmail.com", a: "anna@example.com", b: "anna+news@example.com", expected: noMatch},
+		"multiple domains":      {spec: "email:gmail.com,googlemail.com", a: "a.b@googlemail.com", b: "ab+x@googlemail.com", expected: fuzzyMatch},
+		"different domain":      {spec: "email:gmail.com", a: "anna@gmail.com", b: "anna@googlemail.com", expected: noMatch},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, compare(c.spec, c.a, c.b))
+			assert.Equal(t, c.expected, compare(c.spec, c.b, c.a), "comparison must be symmetric")
+		})
+	}
+}
+
+func TestNormalizedRules(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: []Rule{
+		{ID: "R1", Fields: []string{"phone"}, Compare: map[string]string{"phone": "phone:49"}},
+		{ID: "R2", Fields: []string{"email"}, Compare: map[string]string{"email": "email:gmail.com"}},
+	}}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		&api.Record{ID: "A", Data: map[string]interface{}{"phone": "+49 30 1234567"}},
+		&api.Record{ID: "B", Data: map[string]interface{}{"phone": "030 1234567", "email": "anna.smith@gmail.com"}},
+		&api.Record{ID: "C", Data: map[string]interface{}{"email": "annasmith+shop@gmail.com"}},
+		&api.Record{ID: "D", Data: map[string]interface{}{"phone": "+43 30 1234567"}},
+	))
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+	if assert.Len(t, entities, 2) {
+		assert.Equal(t, []string{"A", "B", "C"}, ids(entities[0].Records))
+	}
+
+	output, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"email": "AnnaSmith@gmail.com",
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Entities, 1) {
+		assert.Equal(t, []string{"A", "B", "C"}, ids(output.Entities[0].Records))
+	}
+}
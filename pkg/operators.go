@@ -0,0 +1,196 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// search operators that can be used in search parameter values, e.g.
+// {"age": {"$gte": 18}}
+const (
+	OperatorEqual        = "$eq"
+	OperatorNotEqual     = "$ne"
+	OperatorGreater      = "$gt"
+	OperatorGreaterEqual = "$gte"
+	OperatorLess         = "$lt"
+	OperatorLessEqual    = "$lte"
+	OperatorPrefix       = "$prefix"
+	OperatorRegex        = "$regex"
+)
+
+// condition is a search parameter value with operators, which matches a value
+// if all of its operators match
+//
+// For slices, the condition matches if the slice as a whole or any of its
+// elements satisfies all predicates and neither the slice nor any of its
+// elements equals an excluded value.
+type condition struct {
+	predicates []func(value interface{}) bool
+	excluded   []interface{}
+}
+
+func (c *condition) matches(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	for _, excluded := range c.excluded {
+		if containsValue(value, excluded) {
+			return false
+		}
+	}
+	if c.satisfies(value) {
+		return true
+	}
+	values, _ := elements(value)
+	for _, v := range values {
+		if c.matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// satisfies returns true if the value satisfies all predicates
+func (c *condition) satisfies(value interface{}) bool {
+	for _, predicate := range c.predicates {
+		if !predicate(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsValue returns true if the value or any of its elements equals x
+func containsValue(value, x interface{}) bool {
+	if equal(value, x) {
+		return true
+	}
+	values, _ := elements(value)
+	for _, v := range values {
+		if containsValue(v, x) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCondition returns a condition if the search parameter value is an
+// object with operators as keys, otherwise it returns the value unchanged
+func parseCondition(key string, value interface{}) (interface{}, error) {
+	operators, ok := value.(map[string]interface{})
+	if !ok || len(operators) == 0 {
+		return value, nil
+	}
+	names := make([]string, 0, len(operators))
+	for name := range operators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// "$" sorts before letters and digits, therefore any operator is first
+	if !strings.HasPrefix(names[0], "$") {
+		return value, nil
+	}
+
+	c := &condition{}
+	for _, name := range names {
+		if name == OperatorNotEqual {
+			c.excluded = append(c.excluded, operators[name])
+			continue
+		}
+		predicate, err := newPredicate(name, operators[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid search parameter %v: %w", key, err)
+		}
+		c.predicates = append(c.predicates, predicate)
+	}
+	return c, nil
+}
+
+func newPredicate(name string, arg interface{}) (func(value interface{}) bool, error) {
+	switch name {
+	case OperatorEqual:
+		return func(value interface{}) bool {
+			return equal(value, arg)
+		}, nil
+	case OperatorGreater, OperatorGreaterEqual, OperatorLess, OperatorLessEqual:
+		return newOrderPredicate(name, arg)
+	case OperatorPrefix:
+		prefix, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("operator %v requires a string", name)
+		}
+		return func(value interface{}) bool {
+			s, ok := value.(string)
+			return ok && strings.HasPrefix(s, prefix)
+		}, nil
+	case OperatorRegex:
+		expr, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("operator %v requires a string", name)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		return func(value interface{}) bool {
+			s, ok := value.(string)
+			return ok && re.MatchString(s)
+		}, nil
+	}
+	if strings.HasPrefix(name, "$") {
+		return nil, fmt.Errorf("unknown operator %v", name)
+	}
+	return nil, fmt.Errorf("operators must not be mixed with other keys like %v", name)
+}
+
+// newOrderPredicate returns a predicate that compares numbers with numbers and
+// strings with strings, e.g. ISO 8601 dates
+func newOrderPredicate(name string, arg interface{}) (func(value interface{}) bool, error) {
+	accept := map[string]func(cmp int) bool{
+		OperatorGreater:      func(cmp int) bool { return cmp > 0 },
+		OperatorGreaterEqual: func(cmp int) bool { return cmp >= 0 },
+		OperatorLess:         func(cmp int) bool { return cmp < 0 },
+		OperatorLessEqual:    func(cmp int) bool { return cmp <= 0 },
+	}[name]
+	if n, ok := toNumber(arg); ok {
+		return func(value interface{}) bool {
+			v, ok := toNumber(value)
+			return ok && accept(compareNumbers(v, n))
+		}, nil
+	}
+	if s, ok := arg.(string); ok {
+		return func(value interface{}) bool {
+			v, ok := value.(string)
+			return ok && accept(strings.Compare(v, s))
+		}, nil
+	}
+	return nil, fmt.Errorf("operator %v requires a number or string", name)
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
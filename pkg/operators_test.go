@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestParseCondition(t *testing.T) {
+	cases := map[string]struct {
+		operators map[string]interface{}
+		matches   []interface{}
+		misses    []interface{}
+	}{
+		"range": {
+			operators: map[string]interface{}{OperatorGreaterEqual: 18.0, OperatorLess: 65},
+			matches:   []interface{}{18.0, 64.5, 30},
+			misses:    []interface{}{17.0, 65.0, "30", nil},
+		},
+		"string range": {
+			operators: map[string]interface{}{OperatorGreater: "1990-01-01", OperatorLessEqual: "1999-12-31"},
+			matches:   []interface{}{"1995-06-15", "1999-12-31"},
+			misses:    []interface{}{"1990-01-01", "2000-01-01", 1995.0},
+		},
+		"prefix": {
+			operators: map[string]interface{}{OperatorPrefix: "Jo"},
+			matches:   []interface{}{"John", "Jo"},
+			misses:    []interface{}{"Anna", "jo", 42.0},
+		},
+		"regex": {
+			operators: map[string]interface{}{OperatorRegex: ".*@example\\.com$"},
+			matches:   []interface{}{"anna@example.com"},
+			misses:    []interface{}{"anna@example.org", "anna@exampleXcom"},
+		},
+		"equal and not equal": {
+			operators: map[string]interface{}{OperatorNotEqual: "Anna", OperatorEqual: "John"},
+			matches:   []interface{}{"John"},
+			misses:    []interface{}{"Anna", nil},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			value, err := parseCondition("field", c.operators)
+			if !assert.NoError(t, err) {
+				return
+			}
+			condition, ok := value.(*condition)
+			if !assert.True(t, ok) {
+				return
+			}
+			for _, v := range c.matches {
+				assert.True(t, condition.matches(v), "%v must match", v)
+			}
+			for _, v := range c.misses {
+				assert.False(t, condition.matches(v), "%v must not match", v)
+			}
+		})
+	}
+}
+
+func TestParseInvalidCondition(t *testing.T) {
+	cases := map[string]struct {
+		operators map[string]interface{}
+		expected  string
+	}{
+		"unknown operator": {
+			operators: map[string]interface{}{"$like": "Jo%"},
+			expected:  "invalid search parameter name: unknown operator $like",
+		},
+		"mixed keys": {
+			operators: map[string]interface{}{OperatorPrefix: "Jo", "first": "John"},
+			expected:  "invalid search parameter name: operators must not be mixed with other keys like first",
+		},
+		"invalid regex": {
+			operators: map[string]interface{}{OperatorRegex: "("},
+			expected:  "invalid search parameter name: invalid regex: error parsing regexp: missing closing ): `(`",
+		},
+		"prefix without string": {
+			operators: map[string]interface{}{OperatorPrefix: 1.0},
+			expected:  "invalid search parameter name: operator $prefix requires a string",
+		},
+		"range without number or string": {
+			operators: map[string]interface{}{OperatorGreater: true},
+			expected:  "invalid search parameter name: operator $gt requires a number or string",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseCondition("name", c.operators)
+			assert.EqualError(t, err, c.expected)
+		})
+	}
+
+	value := map[string]interface{}{"street": "Main St"}
+	actual, err := parseCondition("address", value)
+	assert.NoError(t, err)
+	assert.Equal(t, value, actual, "objects without operators must be kept")
+}
+
+func TestSearchOperators(t *testing.T) {
+	records := []*api.Record{
+		{ID: "A", Data: map[string]interface{}{"name": "John", "age": 17.0, "email": "john@example.com"}},
+		{ID: "B", Data: map[string]interface{}{"name": "Joanna", "age": 35.0, "email": "joanna@example.org"}},
+		{ID: "C", Data: map[string]interface{}{"name": "Anna", "age": 42.0, "email": "anna@example.com"}},
+	}
+	ctx := context.Background()
+
+	withRules := &FakeDispatcher{Rules: []Rule{
+		{ID: "R1", Fields: []string{"name", "age"}},
+		{ID: "R2", Fields: []string{"email"}},
+	}}
+	_, err := withRules.Submit(ctx, createSubmitInput(records...))
+	assert.NoError(t, err)
+	output, err := withRules.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"name": map[string]interface{}{OperatorPrefix: "Jo"},
+		"age":  map[string]interface{}{OperatorGreaterEqual: 18.0},
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Entities, 1) {
+		assert.Equal(t, api.Hits{"B": {"R1"}}, output.Entities[0].Hits)
+	}
+	output, err = withRules.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"email": map[string]interface{}{OperatorRegex: "@example\\.com$"},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, output.Entities, 2)
+
+	withoutRules := &FakeDispatcher{}
+	_, err = withoutRules.Submit(ctx, createSubmitInput(records...))
+	assert.NoError(t, err)
+	output, err = withoutRules.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"age": map[string]interface{}{OperatorGreater: 30.0},
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Entities, 1) {
+		assert.Equal(t, []string{"B", "C"}, ids(output.Entities[0].Records))
+	}
+
+	_, err = withoutRules.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"age": map[string]interface{}{"$between": []interface{}{18.0, 30.0}},
+	}})
+	assert.EqualError(t, err, "invalid search parameter age: unknown operator $between")
+}
@@ -0,0 +1,207 @@
+// Package quality compares the entities created by a dispatcher with a
+// labelled ground truth.
+//
+// The comparison is based on record pairs: each pair of records within the same
+// entity is a predicted pair, each pair of records with the same true entity is
+// a true pair.
+package quality
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	api "github.com/tilotech/tilores-plugin-api"
+)
+
+// Report contains the quality metrics and all wrongly resolved entities
+type Report struct {
+	Records           int      `json:"records"`
+	UnlabelledRecords []string `json:"unlabelledRecords"`
+	MissingRecords    []string `json:"missingRecords"`
+
+	PredictedPairs int `json:"predictedPairs"`
+	TruePairs      int `json:"truePairs"`
+	CorrectPairs   int `json:"correctPairs"`
+
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+
+	WrongMerges []WrongMerge `json:"wrongMerges"`
+	WrongSplits []WrongSplit `json:"wrongSplits"`
+}
+
+// WrongMerge is an entity that contains records of different true entities
+type WrongMerge struct {
+	EntityID     string              `json:"entityID"`
+	TrueEntities map[string][]string `json:"trueEntities"` // true entity id -> record ids
+}
+
+// WrongSplit is a true entity whose records are spread across multiple entities
+type WrongSplit struct {
+	TrueEntityID string              `json:"trueEntityID"`
+	Entities     map[string][]string `json:"entities"` // entity id -> record ids
+}
+
+// Evaluate compares the entities with the ground truth, which maps each record
+// id to its true entity id
+//
+// Records that are not part of the ground truth are listed as unlabelled and
+// ignored for all metrics. Records of the ground truth that are not part of any
+// entity are listed as missing; the true pairs are counted from the ground truth,
+// so missing records lower the recall.
+//
+// Without any predicted pairs the precision is 1, without any true pairs the
+// recall is 1.
+func Evaluate(entities []*api.Entity, groundTruth map[string]string) *Report {
+	report := &Report{
+		UnlabelledRecords: []string{},
+		MissingRecords:    []string{},
+		WrongMerges:       []WrongMerge{},
+		WrongSplits:       []WrongSplit{},
+	}
+
+	byEntity := map[string]map[string][]string{}     // entity -> true entity -> records
+	byTrueEntity := map[string]map[string][]string{} // true entity -> entity -> records
+	seen := map[string]bool{}
+	for _, entity := range entities {
+		for _, record := range entity.Records {
+			seen[record.ID] = true
+			trueEntityID, ok := groundTruth[record.ID]
+			if !ok {
+				report.UnlabelledRecords = append(report.UnlabelledRecords, record.ID)
+				continue
+			}
+			report.Records++
+			add(byEntity, entity.ID, trueEntityID, record.ID)
+			add(byTrueEntity, trueEntityID, entity.ID, record.ID)
+		}
+	}
+	for recordID := range groundTruth {
+		if !seen[recordID] {
+			report.MissingRecords = append(report.MissingRecords, recordID)
+		}
+	}
+	sort.Strings(report.UnlabelledRecords)
+	sort.Strings(report.MissingRecords)
+
+	for entityID, trueEntities := range byEntity {
+		size := 0
+		for _, recordIDs := range trueEntities {
+			size += len(recordIDs)
+			report.CorrectPairs += pairs(len(recordIDs))
+		}
+		report.PredictedPairs += pairs(size)
+		if len(trueEntities) > 1 {
+			report.WrongMerges = append(report.WrongMerges, WrongMerge{
+				EntityID:     entityID,
+				TrueEntities: trueEntities,
+			})
+		}
+	}
+	trueSizes := map[string]int{}
+	for _, trueEntityID := range groundTruth {
+		trueSizes[trueEntityID]++
+	}
+	for _, size := range trueSizes {
+		report.TruePairs += pairs(size)
+	}
+	for trueEntityID, entities := range byTrueEntity {
+		if len(entities) > 1 {
+			report.WrongSplits = append(report.WrongSplits, WrongSplit{
+				TrueEntityID: trueEntityID,
+				Entities:     entities,
+			})
+		}
+	}
+	sort.Slice(report.WrongMerges, func(i, j int) bool {
+		return report.WrongMerges[i].EntityID < report.WrongMerges[j].EntityID
+	})
+	sort.Slice(report.WrongSplits, func(i, j int) bool {
+		return report.WrongSplits[i].TrueEntityID < report.WrongSplits[j].TrueEntityID
+	})
+
+	report.Precision = ratio(report.CorrectPairs, report.PredictedPairs)
+	report.Recall = ratio(report.CorrectPairs, report.TruePairs)
+	if report.Precision+report.Recall > 0 {
+		report.F1 = 2 * report.Precision * report.Recall / (report.Precision + report.Recall)
+	}
+	return report
+}
+
+// WriteText writes a human readable summary of the report
+func (r *Report) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `records:         %v (unlabelled: %v, missing: %v)
+predicted pairs: %v
+true pairs:      %v
+correct pairs:   %v
+precision:       %.4f
+recall:          %.4f
+f1:              %.4f
+wrong merges:    %v
+wrong splits:    %v
+`,
+		r.Records, len(r.UnlabelledRecords), len(r.MissingRecords),
+		r.PredictedPairs, r.TruePairs, r.CorrectPairs,
+		r.Precision, r.Recall, r.F1,
+		len(r.WrongMerges), len(r.WrongSplits),
+	)
+	if err != nil {
+		return err
+	}
+	for _, merge := range r.WrongMerges {
+		_, err = fmt.Fprintf(w, "\nwrong merge of entity %v:\n", merge.EntityID)
+		if err != nil {
+			return err
+		}
+		err = writeGroups(w, merge.TrueEntities, "true entity")
+		if err != nil {
+			return err
+		}
+	}
+	for _, split := range r.WrongSplits {
+		_, err = fmt.Fprintf(w, "\nwrong split of true entity %v:\n", split.TrueEntityID)
+		if err != nil {
+			return err
+		}
+		err = writeGroups(w, split.Entities, "entity")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeGroups(w io.Writer, groups map[string][]string, label string) error {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		_, err := fmt.Fprintf(w, "  %v %v: %v\n", label, key, groups[key])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func add(groups map[string]map[string][]string, outer, inner, recordID string) {
+	if groups[outer] == nil {
+		groups[outer] = map[string][]string{}
+	}
+	groups[outer][inner] = append(groups[outer][inner], recordID)
+}
+
+func pairs(n int) int {
+	return n * (n - 1) / 2
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 1
+	}
+	return float64(a) / float64(b)
+}
@@ -0,0 +1,96 @@
+package quality
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+)
+
+func TestEvaluate(t *testing.T) {
+	entities := []*api.Entity{
+		entity("e1", "1", "2", "3"),
+		entity("e2", "4"),
+		entity("e3", "5", "6", "x"),
+	}
+	groundTruth := map[string]string{
+		"1": "p1",
+		"2": "p1",
+		"3": "p2",
+		"4": "p2",
+		"5": "p3",
+		"6": "p3",
+		"7": "p4",
+	}
+
+	actual := Evaluate(entities, groundTruth)
+
+	assert.Equal(t, 6, actual.Records)
+	assert.Equal(t, []string{"x"}, actual.UnlabelledRecords)
+	assert.Equal(t, []string{"7"}, actual.MissingRecords)
+	assert.Equal(t, 4, actual.PredictedPairs)
+	assert.Equal(t, 3, actual.TruePairs)
+	assert.Equal(t, 2, actual.CorrectPairs)
+	assert.InDelta(t, 0.5, actual.Precision, 0.0001)
+	assert.InDelta(t, 0.6667, actual.Recall, 0.0001)
+	assert.InDelta(t, 0.5714, actual.F1, 0.0001)
+	assert.Equal(t, []WrongMerge{
+		{EntityID: "e1", TrueEntities: map[string][]string{"p1": {"1", "2"}, "p2": {"3"}}},
+	}, actual.WrongMerges)
+	assert.Equal(t, []WrongSplit{
+		{TrueEntityID: "p2", Entities: map[string][]string{"e1": {"3"}, "e2": {"4"}}},
+	}, actual.WrongSplits)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, actual.WriteText(buf))
+	assert.Equal(t, `records:         6 (unlabelled: 1, missing: 1)
+predicted pairs: 4
+true pairs:      3
+correct pairs:   2
+precision:       0.5000
+recall:          0.6667
+f1:              0.5714
+wrong merges:    1
+wrong splits:    1
+
+wrong merge of entity e1:
+  true entity p1: [1 2]
+  true entity p2: [3]
+
+wrong split of true entity p2:
+  entity e1: [3]
+  entity e2: [4]
+`, buf.String())
+}
+
+func TestEvaluatePerfect(t *testing.T) {
+	actual := Evaluate([]*api.Entity{entity("e1", "1"), entity("e2", "2")}, map[string]string{"1": "p1", "2": "p2"})
+	assert.Equal(t, 0, actual.PredictedPairs)
+	assert.Equal(t, 0, actual.TruePairs)
+	assert.Equal(t, 1.0, actual.Precision)
+	assert.Equal(t, 1.0, actual.Recall)
+	assert.Equal(t, 1.0, actual.F1)
+	assert.Empty(t, actual.WrongMerges)
+	assert.Empty(t, actual.WrongSplits)
+}
+
+func TestEvaluateMissingRecord(t *testing.T) {
+	actual := Evaluate([]*api.Entity{entity("e1", "1", "2")}, map[string]string{"1": "p1", "2": "p1", "3": "p1"})
+	assert.Equal(t, []string{"3"}, actual.MissingRecords)
+	assert.Equal(t, 1, actual.PredictedPairs)
+	assert.Equal(t, 3, actual.TruePairs, "pairs with missing records must be counted")
+	assert.Equal(t, 1, actual.CorrectPairs)
+	assert.Equal(t, 1.0, actual.Precision)
+	assert.InDelta(t, 0.3333, actual.Recall, 0.0001)
+	assert.InDelta(t, 0.5, actual.F1, 0.0001)
+	assert.Empty(t, actual.WrongSplits)
+}
+
+func entity(id string, recordIDs ...string) *api.Entity {
+	e := &api.Entity{ID: id}
+	for _, recordID := range recordIDs {
+		e.Records = append(e.Records, &api.Record{ID: recordID})
+	}
+	return e
+}
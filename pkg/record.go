@@ -0,0 +1,272 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// method names used in recorded calls
+const (
+	methodEntity              = "Entity"
+	methodSubmit              = "Submit"
+	methodSearch              = "Search"
+	methodDisassemble         = "Disassemble"
+	methodRemoveConnectionBan = "RemoveConnectionBan"
+)
+
+// RecordedCall represents a single dispatcher call including its response
+//
+// Recorded calls are written as one JSON object per line (JSONL).
+type RecordedCall struct {
+	Method string          `json:"method"`
+	Input  json.RawMessage `json:"input"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Recorder wraps a Dispatcher and records every call and its response as JSONL
+//
+// Calls are forwarded one at a time, so that they are recorded in the order in
+// which they ran and can be replayed in that order.
+type Recorder struct {
+	// OnError is called with errors that occur while recording a call, if set,
+	// recording errors never fail the call itself
+	OnError func(err error)
+
+	dispatcher dispatcher.Dispatcher
+	mu         sync.Mutex
+	w          io.Writer
+}
+
+// NewRecorder returns a Recorder that forwards all calls to the given
+// Dispatcher and writes them to w
+func NewRecorder(d dispatcher.Dispatcher, w io.Writer) *Recorder {
+	return &Recorder{
+		dispatcher: d,
+		w:          w,
+	}
+}
+
+// Entity forwards and records the Entity call
+func (r *Recorder) Entity(ctx context.Context, input *dispatcher.EntityInput) (*dispatcher.EntityOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	output, err := r.dispatcher.Entity(ctx, input)
+	r.record(methodEntity, input, output, err)
+	return output, err
+}
+
+// Submit forwards and records the Submit call
+func (r *Recorder) Submit(ctx context.Context, input *dispatcher.SubmitInput) (*dispatcher.SubmitOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	output, err := r.dispatcher.Submit(ctx, input)
+	r.record(methodSubmit, input, output, err)
+	return output, err
+}
+
+// Search forwards and records the Search call
+func (r *Recorder) Search(ctx context.Context, input *dispatcher.SearchInput) (*dispatcher.SearchOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	output, err := r.dispatcher.Search(ctx, input)
+	r.record(methodSearch, input, output, err)
+	return output, err
+}
+
+// Disassemble forwards and records the Disassemble call
+func (r *Recorder) Disassemble(ctx context.Context, input *dispatcher.DisassembleInput) (*dispatcher.DisassembleOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	output, err := r.dispatcher.Disassemble(ctx, input)
+	r.record(methodDisassemble, input, output, err)
+	return output, err
+}
+
+// RemoveConnectionBan forwards and records the RemoveConnectionBan call
+func (r *Recorder) RemoveConnectionBan(ctx context.Context, input *dispatcher.RemoveConnectionBanInput) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.dispatcher.RemoveConnectionBan(ctx, input)
+	r.record(methodRemoveConnectionBan, input, nil, err)
+	return err
+}
+
+// record writes the call and reports recording errors to OnError
+//
+// record MUST be called while r.mu is locked.
+func (r *Recorder) record(method string, input interface{}, output interface{}, callErr error) {
+	line, err := recordedLine(method, input, output, callErr)
+	if err == nil {
+		_, err = r.w.Write(line)
+	}
+	if err != nil && r.OnError != nil {
+		r.OnError(fmt.Errorf("failed to record %v call: %w", method, err))
+	}
+}
+
+// recordedLine returns the call as JSON line
+func recordedLine(method string, input interface{}, output interface{}, callErr error) ([]byte, error) {
+	call := RecordedCall{
+		Method: method,
+	}
+	var err error
+	call.Input, err = json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	if callErr != nil {
+		call.Error = callErr.Error()
+	} else if output != nil {
+		call.Output, err = json.Marshal(output)
+		if err != nil {
+			return nil, err
+		}
+	}
+	line, err := json.Marshal(call)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// Mismatch describes a replayed call whose response differs from the recorded
+// one
+type Mismatch struct {
+	Line     int
+	Method   string
+	Expected string
+	Actual   string
+}
+
+// Replay reads recorded calls from r, invokes them in order on the given
+// Dispatcher and returns all calls whose response differs from the recorded
+// response.
+//
+// Search results from the fake dispatcher use random entity IDs, therefore
+// entity IDs are ignored when comparing Search responses.
+//
+// Replay fails if a line is not a recorded call of a known method with a valid
+// input, e.g. because the file is corrupt.
+func Replay(ctx context.Context, d dispatcher.Dispatcher, r io.Reader) ([]Mismatch, error) {
+	mismatches := []Mismatch{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		call := RecordedCall{}
+		err := json.Unmarshal(scanner.Bytes(), &call)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recorded call in line %v: %w", line, err)
+		}
+		expected, err := normalizeResponse(call.Method, call.Output, call.Error)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recorded response in line %v: %w", line, err)
+		}
+		input, err := parseInput(call.Method, call.Input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recorded call in line %v: %w", line, err)
+		}
+		output, callErr := invoke(ctx, d, input)
+		actual, err := response(call.Method, output, callErr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay line %v: %w", line, err)
+		}
+		if expected != actual {
+			mismatches = append(mismatches, Mismatch{
+				Line:     line,
+				Method:   call.Method,
+				Expected: expected,
+				Actual:   actual,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
+
+// parseInput returns the typed input of the recorded call
+func parseInput(method string, rawInput json.RawMessage) (interface{}, error) {
+	var input interface{}
+	switch method {
+	case methodEntity:
+		input = &dispatcher.EntityInput{}
+	case methodSubmit:
+		input = &dispatcher.SubmitInput{}
+	case methodSearch:
+		input = &dispatcher.SearchInput{}
+	case methodDisassemble:
+		input = &dispatcher.DisassembleInput{}
+	case methodRemoveConnectionBan:
+		input = &dispatcher.RemoveConnectionBanInput{}
+	default:
+		return nil, fmt.Errorf("invalid method %v", method)
+	}
+	if err := json.Unmarshal(rawInput, input); err != nil {
+		return nil, fmt.Errorf("invalid %v input: %w", method, err)
+	}
+	return input, nil
+}
+
+func invoke(ctx context.Context, d dispatcher.Dispatcher, input interface{}) (interface{}, error) {
+	switch input := input.(type) {
+	case *dispatcher.EntityInput:
+		return d.Entity(ctx, input)
+	case *dispatcher.SubmitInput:
+		return d.Submit(ctx, input)
+	case *dispatcher.SearchInput:
+		return d.Search(ctx, input)
+	case *dispatcher.DisassembleInput:
+		return d.Disassemble(ctx, input)
+	case *dispatcher.RemoveConnectionBanInput:
+		return nil, d.RemoveConnectionBan(ctx, input)
+	}
+	return nil, fmt.Errorf("unsupported input %T", input)
+}
+
+// response converts the actual output into the same normalized form as the
+// recorded response
+func response(method string, output interface{}, callErr error) (string, error) {
+	if callErr != nil {
+		return normalizeResponse(method, nil, callErr.Error())
+	}
+	raw, err := json.Marshal(output)
+	if err != nil {
+		return "", err
+	}
+	return normalizeResponse(method, raw, "")
+}
+
+func normalizeResponse(method string, raw json.RawMessage, errMsg string) (string, error) {
+	if errMsg != "" {
+		return "error: " + errMsg, nil
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return "null", nil
+	}
+	if method != methodSearch {
+		return string(raw), nil
+	}
+	output := &dispatcher.SearchOutput{}
+	err := json.Unmarshal(raw, output)
+	if err != nil {
+		return "", err
+	}
+	for _, entity := range output.Entities {
+		entity.ID = ""
+	}
+	normalized, err := json.Marshal(output)
+	return string(normalized), err
+}
@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+	recorder := NewRecorder(&FakeDispatcher{}, buf)
+
+	_, err := recorder.Submit(ctx, createSubmitInput(record("1"), record("2"), record("3")))
+	assert.NoError(t, err)
+	_, err = recorder.Entity(ctx, &dispatcher.EntityInput{ID: "foo-id"})
+	assert.NoError(t, err)
+	_, err = recorder.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{"isOdd": true}})
+	assert.NoError(t, err)
+	_, err = recorder.Disassemble(ctx, &dispatcher.DisassembleInput{})
+	assert.Error(t, err)
+
+	recorded := buf.String()
+	assert.Equal(t, 4, strings.Count(recorded, "\n"))
+	assert.Contains(t, recorded, `"method":"Submit"`)
+	assert.Contains(t, recorded, `"error":"no edges or records provided for disassemble"`)
+
+	mismatches, err := Replay(ctx, &FakeDispatcher{}, strings.NewReader(recorded))
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	prefilled := &FakeDispatcher{}
+	_, err = prefilled.Submit(ctx, createSubmitInput(record("5")))
+	assert.NoError(t, err)
+	mismatches, err = Replay(ctx, prefilled, strings.NewReader(recorded))
+	assert.NoError(t, err)
+	if assert.Len(t, mismatches, 2) {
+		assert.Equal(t, 2, mismatches[0].Line)
+		assert.Equal(t, "Entity", mismatches[0].Method)
+		assert.Equal(t, 3, mismatches[1].Line)
+		assert.Equal(t, "Search", mismatches[1].Method)
+	}
+}
+
+func TestReplayInvalidInput(t *testing.T) {
+	cases := map[string]struct {
+		recorded string
+		expected string
+	}{
+		"unknown method": {
+			recorded: "{\"method\":\"Unknown\",\"input\":{}}\n",
+			expected: "invalid recorded call in line 1: invalid method Unknown",
+		},
+		"invalid input": {
+			recorded: "\n{\"method\":\"Entity\",\"input\":{\"id\":1}}\n",
+			expected: "invalid recorded call in line 2: invalid Entity input: json: cannot unmarshal number into Go struct field EntityInput.id of type string",
+		},
+		"no json": {
+			recorded: "{\"method\":\"Entity\",\"input\":{\"id\":\"1\"},\"output\":{\"entity\":null}}\nnot json\n",
+			expected: "invalid recorded call in line 2: invalid character 'o' in literal null (expecting 'u')",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Replay(context.Background(), &FakeDispatcher{}, strings.NewReader(c.recorded))
+			assert.EqualError(t, err, c.expected)
+		})
+	}
+}
+
+func TestRecorderWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	fake := &FakeDispatcher{}
+	recorder := NewRecorder(fake, failingWriter{})
+	errs := []string{}
+	recorder.OnError = func(err error) {
+		errs = append(errs, err.Error())
+	}
+
+	output, err := recorder.Submit(ctx, createSubmitInput(record("1")))
+	assert.NoError(t, err, "recording errors must not fail committed calls")
+	assert.Equal(t, 1, output.RecordsAdded)
+	assert.Len(t, fake.Records(), 1)
+	assert.Equal(t, []string{"failed to record Submit call: disk full"}, errs)
+}
+
+func TestRecorderOrder(t *testing.T) {
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+	recorder := NewRecorder(&FakeDispatcher{Capacity: 100}, buf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = recorder.Submit(ctx, createSubmitInput(record(strconv.Itoa(i))))
+			_, _ = recorder.Entity(ctx, &dispatcher.EntityInput{ID: "foo-id"})
+		}(i)
+	}
+	wg.Wait()
+
+	mismatches, err := Replay(ctx, &FakeDispatcher{Capacity: 100}, strings.NewReader(buf.String()))
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches, "concurrent calls must be recorded in the order in which they ran")
+}
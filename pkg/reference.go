@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+// processedCall is a successful Disassemble or RemoveConnectionBan call that
+// is identified by its reference
+type processedCall struct {
+	call   string
+	output *dispatcher.DisassembleOutput
+}
+
+// referencedCall returns a representation of the call that is used to detect
+// whether a reference is reused with different parameters
+//
+// The timeout is ignored, since it does not affect the result. Record IDs,
+// edges and other entity IDs are sets, therefore their order, the direction of
+// edges and duplicates are ignored as well.
+func referencedCall(method string, input interface{}) (string, error) {
+	switch in := input.(type) {
+	case *dispatcher.DisassembleInput:
+		normalized := *in
+		normalized.Timeout = nil
+		normalized.RecordIDs = uniqueSorted(in.RecordIDs)
+		normalized.Edges = normalizeEdges(in.Edges)
+		input = &normalized
+	case *dispatcher.RemoveConnectionBanInput:
+		normalized := *in
+		normalized.Others = uniqueSorted(in.Others)
+		input = &normalized
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	return method + " " + string(data), nil
+}
+
+// uniqueSorted returns a sorted copy of the values without duplicates
+func uniqueSorted(values []string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// normalizeEdges returns a sorted copy of the edges without duplicates, where
+// A is the smaller record id of each edge
+func normalizeEdges(edges []dispatcher.DisassembleEdge) []dispatcher.DisassembleEdge {
+	normalized := []dispatcher.DisassembleEdge{}
+	seen := map[dispatcher.DisassembleEdge]bool{}
+	for _, edge := range edges {
+		if edge.B < edge.A {
+			edge.A, edge.B = edge.B, edge.A
+		}
+		if !seen[edge] {
+			seen[edge] = true
+			normalized = append(normalized, edge)
+		}
+	}
+	sort.Slice(normalized, func(i, j int) bool {
+		if normalized[i].A != normalized[j].A {
+			return normalized[i].A < normalized[j].A
+		}
+		return normalized[i].B < normalized[j].B
+	})
+	return normalized
+}
+
+// previousCall returns the call that was already processed using the given
+// reference or nil if the reference is empty or was not used yet
+//
+// An error is returned if the reference was used for a different call.
+func (f *FakeDispatcher) previousCall(reference string, call string) (*processedCall, error) {
+	if reference == "" {
+		return nil, nil
+	}
+	previous, ok := f.references[reference]
+	if !ok {
+		return nil, nil
+	}
+	if previous.call != call {
+		return nil, fmt.Errorf("reference %v was already used with different parameters", reference)
+	}
+	return previous, nil
+}
+
+// rememberCall stores the successful call for the given reference
+func (f *FakeDispatcher) rememberCall(reference string, call string, output *dispatcher.DisassembleOutput) {
+	if reference == "" {
+		return
+	}
+	if f.references == nil {
+		f.references = map[string]*processedCall{}
+	}
+	f.references[reference] = &processedCall{
+		call:   call,
+		output: copyDisassembleOutput(output),
+	}
+}
+
+func copyDisassembleOutput(output *dispatcher.DisassembleOutput) *dispatcher.DisassembleOutput {
+	if output == nil {
+		return nil
+	}
+	c := *output
+	c.EntityIDs = append([]string{}, output.EntityIDs...)
+	return &c
+}
@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestDisassembleIsIdempotent(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+		person("C", "Ann", "Smith", "c@example.com"),
+	))
+	assert.NoError(t, err)
+
+	input := &dispatcher.DisassembleInput{
+		Reference:           "ref",
+		Edges:               []dispatcher.DisassembleEdge{{A: "B", B: "C"}},
+		CreateConnectionBan: true,
+	}
+	expected, err := fixture.Disassemble(ctx, input)
+	assert.NoError(t, err)
+
+	timeout := time.Second
+	retry := *input
+	retry.Timeout = &timeout
+	actual, err := fixture.Disassemble(ctx, &retry)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	audit, err := fixture.Audit(ctx, &AuditInput{})
+	assert.NoError(t, err)
+	assert.Len(t, audit.Entries, 1, "retries must not be audited")
+
+	_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Reference: "ref",
+		Edges:     []dispatcher.DisassembleEdge{{A: "A", B: "B"}},
+	})
+	assert.EqualError(t, err, "reference ref was already used with different parameters")
+	assert.Len(t, fixture.Entities(), 2)
+
+	banInput := &dispatcher.RemoveConnectionBanInput{
+		Reference: "ref",
+		EntityID:  expected.EntityIDs[0],
+		Others:    expected.EntityIDs[1:],
+	}
+	err = fixture.RemoveConnectionBan(ctx, banInput)
+	assert.EqualError(t, err, "reference ref was already used with different parameters")
+
+	banInput.Reference = "another-ref"
+	assert.NoError(t, fixture.RemoveConnectionBan(ctx, banInput))
+	assert.NoError(t, fixture.RemoveConnectionBan(ctx, banInput), "a retry must not fail, although the ban no longer exists")
+	assert.Len(t, fixture.Entities(), 1)
+}
+
+func TestReferenceIgnoresOrder(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Ann", "Smith", "anna@example.com"),
+		person("C", "Ann", "Smith", "c@example.com"),
+		person("D", "Ann", "Smith", "d@example.com"),
+	))
+	assert.NoError(t, err)
+
+	expected, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Reference: "ref",
+		Edges:     []dispatcher.DisassembleEdge{{A: "A", B: "B"}, {A: "B", B: "C"}},
+		RecordIDs: []string{"C", "D"},
+	})
+	assert.NoError(t, err)
+	actual, err := fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Reference: "ref",
+		Edges:     []dispatcher.DisassembleEdge{{A: "C", B: "B"}, {A: "A", B: "B"}},
+		RecordIDs: []string{"D", "C", "D"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	a, err := referencedCall(methodRemoveConnectionBan, &dispatcher.RemoveConnectionBanInput{Reference: "ref", EntityID: "e1", Others: []string{"e2", "e3"}})
+	assert.NoError(t, err)
+	b, err := referencedCall(methodRemoveConnectionBan, &dispatcher.RemoveConnectionBanInput{Reference: "ref", EntityID: "e1", Others: []string{"e3", "e2"}})
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+}
+
+func TestDisassembleWithoutReferenceIsNotIdempotent(t *testing.T) {
+	fixture := &FakeDispatcher{}
+	ctx := context.Background()
+	_, err := fixture.Submit(ctx, createSubmitInput(record("1")))
+	assert.NoError(t, err)
+
+	input := &dispatcher.DisassembleInput{RecordIDs: []string{"1"}}
+	_, err = fixture.Disassemble(ctx, input)
+	assert.NoError(t, err)
+	_, err = fixture.Disassemble(ctx, input)
+	assert.EqualError(t, err, "record 1 does not exist")
+}
+
+func TestFailedDisassembleCanBeRetried(t *testing.T) {
+	fixture := &FakeDispatcher{}
+	ctx := context.Background()
+
+	input := &dispatcher.DisassembleInput{Reference: "ref", RecordIDs: []string{"1"}}
+	_, err := fixture.Disassemble(ctx, input)
+	assert.EqualError(t, err, "record 1 does not exist")
+
+	_, err = fixture.Submit(ctx, createSubmitInput(record("1")))
+	assert.NoError(t, err)
+	output, err := fixture.Disassemble(ctx, input)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), output.DeletedRecords)
+}
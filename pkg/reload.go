@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/tilotech/tilores-plugin-api"
+)
+
+// ReloadInput includes the data required to replace the rules
+type ReloadInput struct {
+	// Rules replaces the current rules, no rules groups all records into a
+	// single entity
+	Rules []Rule `json:"rules"`
+
+	// Recluster recalculates the entities of all stored records using the new
+	// rules, otherwise the new rules only apply to records submitted later
+	Recluster bool `json:"recluster"`
+}
+
+// ReloadOutput contains the entity events caused by reclustering
+type ReloadOutput struct {
+	Changes []Event `json:"changes"`
+}
+
+// Reload replaces the rules without losing the stored records
+//
+// The rules are replaced atomically, i.e. concurrent calls either see the old
+// or the new rules and entities. Switching between rules and no rules while
+// records are stored requires reclustering. Reclustering keeps the connection
+// bans and the ids of entities that still contain records of the same previous
+// entity. Without rules, connection bans are removed.
+func (f *FakeDispatcher) Reload(_ context.Context, input *ReloadInput) (*ReloadOutput, error) {
+	err := ValidateRules(input.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switching := f.clustering() != (len(input.Rules) != 0)
+	if switching && !input.Recluster && f.length != 0 {
+		return nil, fmt.Errorf("switching between rules and no rules requires reclustering")
+	}
+
+	now := f.currentTime()
+	wasClustering := f.clustering()
+	f.Rules = input.Rules
+	events := []Event{}
+	switch {
+	case !f.clustering():
+		if f.store != nil {
+			previous := f.store.entities
+			recordIDs := make([]string, 0, len(f.store.entityIDs))
+			for recordID := range f.store.entityIDs {
+				recordIDs = append(recordIDs, recordID)
+			}
+			f.store = nil
+			f.recordHistory().updateMemberships(now, map[string]string{}, recordIDs)
+			events = entityEvents(previous, nil, newEntityStore(nil))
+		}
+	case !input.Recluster:
+		f.entityStore().setRules(f.Rules)
+	case wasClustering:
+		f.entityStore().recluster(f.Rules)
+		events = f.rebuild(now)
+	default:
+		store := f.entityStore()
+		for _, record := range f.uniqueRecords(now) {
+			store.add(record)
+		}
+		events = f.rebuild(now)
+	}
+
+	f.emit(now, events...)
+	return &ReloadOutput{
+		Changes: events,
+	}, nil
+}
+
+// uniqueRecords removes all but the newest version of records that were
+// submitted multiple times without rules and returns the remaining records
+// ordered from oldest to newest
+func (f *FakeDispatcher) uniqueRecords(now time.Time) []*api.Record {
+	records := f.oldestFirst()
+	newest := make(map[string]*api.Record, len(records))
+	for _, record := range records {
+		newest[record.ID] = record
+	}
+	unique := make([]*api.Record, 0, len(newest))
+	for _, record := range records {
+		if newest[record.ID] == record {
+			unique = append(unique, record)
+		} else {
+			f.recordHistory().removed(now, record)
+		}
+	}
+	if len(unique) != len(records) {
+		f.replaceRecords(unique)
+	}
+	return unique
+}
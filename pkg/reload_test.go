@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestReloadRecluster(t *testing.T) {
+	emailRule := []Rule{{ID: "R2", Fields: []string{"email"}}}
+	fixture := &FakeDispatcher{Rules: emailRule}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "smith@example.com"),
+		person("C", "John", "Doe", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+	if !assert.Len(t, entities, 2) {
+		return
+	}
+	e1, e2 := entities[0].ID, entities[1].ID
+
+	output, err := fixture.Reload(ctx, &ReloadInput{Rules: testRules, Recluster: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{
+		{Sequence: 6, Time: output.Changes[0].Time, Type: EventEntitiesMerged, EntityID: e1, EntityIDs: []string{e1, e2}},
+	}, output.Changes)
+	assert.Equal(t, testRules, fixture.Rules)
+	entities = fixture.Entities()
+	if assert.Len(t, entities, 1) {
+		assert.Equal(t, []string{"A", "B", "C"}, ids(entities[0].Records))
+	}
+
+	output, err = fixture.Reload(ctx, &ReloadInput{Rules: testRules[:1], Recluster: true})
+	assert.NoError(t, err)
+	entities = fixture.Entities()
+	if assert.Len(t, entities, 2) {
+		assert.Equal(t, e1, entities[0].ID)
+		assert.Equal(t, []string{"A", "B"}, ids(entities[0].Records))
+		assert.Equal(t, []string{"C"}, ids(entities[1].Records))
+		if assert.Len(t, output.Changes, 1) {
+			assert.Equal(t, EventEntitySplit, output.Changes[0].Type)
+			assert.Equal(t, []string{e1, entities[1].ID}, output.Changes[0].EntityIDs)
+		}
+	}
+}
+
+func TestReloadWithoutRecluster(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules[:1]}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "John", "Doe", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+
+	output, err := fixture.Reload(ctx, &ReloadInput{Rules: testRules})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Changes)
+	assert.Len(t, fixture.Entities(), 2)
+
+	_, err = fixture.Submit(ctx, createSubmitInput(person("C", "Jane", "Roe", "anna@example.com")))
+	assert.NoError(t, err)
+	entities := fixture.Entities()
+	if assert.Len(t, entities, 1) {
+		assert.Equal(t, []string{"A", "B", "C"}, ids(entities[0].Records))
+	}
+}
+
+func TestReloadSwitchingRules(t *testing.T) {
+	fixture := &FakeDispatcher{}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "John", "Doe", "john@example.com"),
+		person("A", "Ann", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+
+	_, err = fixture.Reload(ctx, &ReloadInput{Rules: testRules})
+	assert.EqualError(t, err, "switching between rules and no rules requires reclustering")
+	assert.Empty(t, fixture.Rules)
+
+	output, err := fixture.Reload(ctx, &ReloadInput{Rules: testRules, Recluster: true})
+	assert.NoError(t, err)
+	assert.Len(t, output.Changes, 2)
+	assert.Equal(t, []string{"B", "A"}, ids(fixture.Records()))
+	entities := fixture.Entities()
+	if assert.Len(t, entities, 2) {
+		assert.Equal(t, "John", entities[0].Records[0].Data["firstName"])
+		assert.Equal(t, "Ann", entities[1].Records[0].Data["firstName"])
+	}
+
+	output, err = fixture.Reload(ctx, &ReloadInput{Recluster: true})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Changes, 2) {
+		assert.Equal(t, EventEntityDeleted, output.Changes[0].Type)
+		assert.Equal(t, EventEntityDeleted, output.Changes[1].Type)
+	}
+	entities = fixture.Entities()
+	if assert.Len(t, entities, 1) {
+		assert.Equal(t, []string{"B", "A"}, ids(entities[0].Records))
+	}
+}
+
+func TestReloadKeepsConnectionBans(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Edges:               []dispatcher.DisassembleEdge{{A: "A", B: "B"}},
+		CreateConnectionBan: true,
+	})
+	assert.NoError(t, err)
+
+	output, err := fixture.Reload(ctx, &ReloadInput{Rules: testRules[1:], Recluster: true})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Changes)
+	assert.Len(t, fixture.Entities(), 2)
+}
+
+func TestReloadInvalidRules(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	_, err := fixture.Reload(context.Background(), &ReloadInput{Rules: []Rule{{ID: "R1"}}})
+	assert.EqualError(t, err, "invalid rules: rule R1 has no fields")
+	assert.Equal(t, testRules, fixture.Rules)
+}
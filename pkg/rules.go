@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule defines when two records belong to the same entity
+//
+// Two records match a rule if all fields of the rule exist in both records and
+// have equal values. Fields with a comparator also match if the comparator
+// considers their values similar, which is a fuzzy match. Fields with multiple
+// values match if any of their values match.
+//
+// With a blocking key, two records only match if they also share a blocking
+// key. Each part of the blocking key is a field, optionally followed by a colon
+// and the number of leading characters that are used. The values are compared
+// ignoring their case and whitespace, but without any comparator.
+type Rule struct {
+	ID     string   `yaml:"id" json:"id"`
+	Fields []string `yaml:"fields" json:"fields"`
+
+	// Compare defines the comparator for some of the fields, e.g. text or
+	// date:1,swap
+	Compare map[string]string `yaml:"compare" json:"compare,omitempty"`
+
+	// Weight defines the search score of an exact match, a fuzzy match scores
+	// half of the weight, defaults to 1
+	Weight float64 `yaml:"weight" json:"weight,omitempty"`
+
+	// Blocking defines the parts of the blocking key, e.g. lastName:3 and zip,
+	// only records with the same blocking key are compared using this rule
+	Blocking []string `yaml:"blocking" json:"blocking,omitempty"`
+}
+
+// rulesFile represents the structure of a rules file
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// ParseRules parses rules from YAML (or JSON) data
+//
+// Example:
+//
+//	rules:
+//	  - id: R1
+//	    fields: [firstName, lastName, dateOfBirth]
+//	  - id: R2
+//	    fields: [email]
+//	    compare:
+//	      email: text
+//	    weight: 2
+//	  - id: R3
+//	    fields: [lastName, zip, street]
+//	    blocking: [lastName:3, zip]
+func ParseRules(data []byte) ([]Rule, error) {
+	file := rulesFile{}
+	err := yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+	err = ValidateRules(file.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return file.Rules, nil
+}
+
+// LoadRules reads and parses the rules from the given file
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
+}
+
+// ValidateRules returns an error if any rule has no ID, no fields, an invalid
+// comparator, a negative weight or an invalid blocking key or if an ID is used
+// more than once
+func ValidateRules(rules []Rule) error {
+	ids := make(map[string]struct{}, len(rules))
+	for i, rule := range rules {
+		if rule.ID == "" {
+			return fmt.Errorf("rule %v has no id", i+1)
+		}
+		if _, ok := ids[rule.ID]; ok {
+			return fmt.Errorf("rule id %v is used more than once", rule.ID)
+		}
+		ids[rule.ID] = struct{}{}
+		if len(rule.Fields) == 0 {
+			return fmt.Errorf("rule %v has no fields", rule.ID)
+		}
+		for field, comparator := range rule.Compare {
+			if !contains(rule.Fields, field) {
+				return fmt.Errorf("rule %v compares field %v, which is not one of its fields", rule.ID, field)
+			}
+			if _, err := parseComparator(comparator); err != nil {
+				return fmt.Errorf("rule %v has an invalid comparator for field %v: %w", rule.ID, field, err)
+			}
+		}
+		if rule.Weight < 0 {
+			return fmt.Errorf("rule %v has a negative weight", rule.ID)
+		}
+		for _, part := range rule.Blocking {
+			if _, err := parseBlockingPart(part); err != nil {
+				return fmt.Errorf("rule %v has an invalid blocking key part %v: %w", rule.ID, part, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matches returns true if all rule fields exist in a and b with equal or
+// similar values
+func (r *Rule) matches(a, b map[string]interface{}) bool {
+	return r.match(a, b) != noMatch
+}
+
+// match returns the worst match of all rule fields
+func (r *Rule) match(a, b map[string]interface{}) match {
+	result := exactMatch
+	for _, field := range r.Fields {
+		m := compare(r.Compare[field], a[field], b[field])
+		if m == noMatch {
+			return noMatch
+		}
+		if m < result {
+			result = m
+		}
+	}
+	return result
+}
+
+// score returns the search score for the given match
+func (r *Rule) score(m match) float64 {
+	weight := r.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	switch m {
+	case exactMatch:
+		return weight
+	case fuzzyMatch:
+		return weight / 2
+	}
+	return 0
+}
+
+// equal compares two values, where missing (nil) values never match
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	actual, err := ParseRules([]byte(`
+rules:
+  - id: R1
+    fields: [firstName, lastName]
+  - id: R2
+    fields:
+      - email
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{ID: "R1", Fields: []string{"firstName", "lastName"}},
+		{ID: "R2", Fields: []string{"email"}},
+	}, actual)
+
+	actual, err = ParseRules([]byte(`{"rules":[{"id":"R1","fields":["email"]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{{ID: "R1", Fields: []string{"email"}}}, actual)
+}
+
+func TestParseInvalidRules(t *testing.T) {
+	cases := map[string]struct {
+		data     string
+		expected string
+	}{
+		"invalid yaml": {
+			data:     "rules: [",
+			expected: "invalid rules: yaml: line 1: did not find expected node content",
+		},
+		"missing id": {
+			data:     "rules: [{fields: [email]}]",
+			expected: "rule 1 has no id",
+		},
+		"duplicate id": {
+			data:     "rules: [{id: R1, fields: [email]}, {id: R1, fields: [phone]}]",
+			expected: "rule id R1 is used more than once",
+		},
+		"missing fields": {
+			data:     "rules: [{id: R1}]",
+			expected: "rule R1 has no fields",
+		},
+		"comparator for other field": {
+			data:     "rules: [{id: R1, fields: [email], compare: {name: text}}]",
+			expected: "rule R1 compares field name, which is not one of its fields",
+		},
+		"unknown comparator": {
+			data:     "rules: [{id: R1, fields: [email], compare: {email: soundex}}]",
+			expected: "rule R1 has an invalid comparator for field email: unknown comparator soundex",
+		},
+		"invalid comparator arguments": {
+			data:     "rules: [{id: R1, fields: [dateOfBirth], compare: {dateOfBirth: \"date:-1\"}}]",
+			expected: "rule R1 has an invalid comparator for field dateOfBirth: invalid comparator date:-1: argument -1 must be swap or a tolerance in days",
+		},
+		"negative weight": {
+			data:     "rules: [{id: R1, fields: [email], weight: -1}]",
+			expected: "rule R1 has a negative weight",
+		},
+		"invalid blocking key length": {
+			data:     "rules: [{id: R1, fields: [lastName], blocking: [\"lastName:0\"]}]",
+			expected: "rule R1 has an invalid blocking key part lastName:0: length 0 must be a positive number",
+		},
+		"empty blocking key field": {
+			data:     "rules: [{id: R1, fields: [lastName], blocking: [\":3\"]}]",
+			expected: "rule R1 has an invalid blocking key part :3: field must not be empty",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseRules([]byte(c.data))
+			assert.EqualError(t, err, c.expected)
+		})
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	rule := Rule{ID: "R1", Fields: []string{"firstName", "lastName"}}
+
+	assert.True(t, rule.matches(
+		map[string]interface{}{"firstName": "Anna", "lastName": "Smith", "email": "a@example.com"},
+		map[string]interface{}{"firstName": "Anna", "lastName": "Smith"},
+	))
+	assert.False(t, rule.matches(
+		map[string]interface{}{"firstName": "Anna", "lastName": "Smith"},
+		map[string]interface{}{"firstName": "Anna", "lastName": "Smyth"},
+	))
+	assert.False(t, rule.matches(
+		map[string]interface{}{"firstName": "Anna"},
+		map[string]interface{}{"firstName": "Anna"},
+	), "missing fields must not match")
+	assert.False(t, rule.matches(
+		map[string]interface{}{"firstName": "Anna", "lastName": nil},
+		map[string]interface{}{"firstName": "Anna", "lastName": nil},
+	), "nil values must not match")
+}
+
+func TestRuleMatch(t *testing.T) {
+	rule := Rule{ID: "R1", Fields: []string{"firstName", "lastName"}, Compare: map[string]string{"lastName": CompareText}, Weight: 3}
+
+	m := rule.match(
+		map[string]interface{}{"firstName": "Anna", "lastName": "Smith"},
+		map[string]interface{}{"firstName": "Anna", "lastName": "Smith"},
+	)
+	assert.Equal(t, exactMatch, m)
+	assert.Equal(t, 3.0, rule.score(m))
+
+	m = rule.match(
+		map[string]interface{}{"firstName": "Anna", "lastName": " van  der Berg"},
+		map[string]interface{}{"firstName": "Anna", "lastName": "Van der Berg"},
+	)
+	assert.Equal(t, fuzzyMatch, m)
+	assert.Equal(t, 1.5, rule.score(m))
+
+	m = rule.match(
+		map[string]interface{}{"firstName": "anna", "lastName": "Smith"},
+		map[string]interface{}{"firstName": "Anna", "lastName": "Smith"},
+	)
+	assert.Equal(t, noMatch, m, "fields without comparator must be equal")
+	assert.Equal(t, 0.0, rule.score(m))
+
+	assert.Equal(t, 1.0, (&Rule{}).score(exactMatch), "weight must default to 1")
+}
@@ -0,0 +1,104 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	api "github.com/tilotech/tilores-plugin-api"
+)
+
+// reserved search parameters for paginating the search results and for
+// requesting the scores
+const (
+	SearchLimitKey  = "_limit"
+	SearchOffsetKey = "_offset"
+
+	// SearchScoreKey requests the scores if true, each score is then returned
+	// using the same key in the entity hits
+	SearchScoreKey = "_score"
+)
+
+// searchOptions defines which of the found entities are returned and whether
+// their scores are included
+type searchOptions struct {
+	offset int
+	limit  int // 0 for no limit
+	score  bool
+}
+
+// parseSearchOptions returns the options defined by the reserved search
+// parameters and the remaining search parameters, where values with operators
+// are replaced by their conditions
+func parseSearchOptions(parameters *api.SearchParameters) (searchOptions, api.SearchParameters, error) {
+	options := searchOptions{}
+	remaining := api.SearchParameters{}
+	if parameters == nil {
+		return options, remaining, nil
+	}
+	for key, value := range *parameters {
+		var err error
+		switch key {
+		case SearchLimitKey:
+			options.limit, err = searchPageValue(key, value, 1)
+		case SearchOffsetKey:
+			options.offset, err = searchPageValue(key, value, 0)
+		case SearchScoreKey:
+			options.score, err = searchScoreValue(value)
+		default:
+			remaining[key], err = parseCondition(key, value)
+		}
+		if err != nil {
+			return options, nil, err
+		}
+	}
+	return options, remaining, nil
+}
+
+// searchPageValue returns the value as integer, which can be provided as JSON
+// number or string and must be at least min
+func searchPageValue(key string, value interface{}, min int) (int, error) {
+	i := -1
+	switch v := value.(type) {
+	case int:
+		i = v
+	case float64:
+		if v == math.Trunc(v) && v <= math.MaxInt32 {
+			i = int(v)
+		}
+	case string:
+		if parsed, err := strconv.Atoi(v); err == nil {
+			i = parsed
+		}
+	}
+	if i < min {
+		return 0, fmt.Errorf("invalid search parameter %v %v, must be an integer of at least %v", key, value, min)
+	}
+	return i, nil
+}
+
+// searchScoreValue returns the value as bool, which can be provided as JSON
+// boolean or string
+func searchScoreValue(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if parsed, err := strconv.ParseBool(v); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, fmt.Errorf("invalid search parameter %v %v, must be a boolean", SearchScoreKey, value)
+}
+
+// page returns the entities of the requested page
+func (o searchOptions) page(entities []*api.Entity) []*api.Entity {
+	if o.offset >= len(entities) {
+		return []*api.Entity{}
+	}
+	entities = entities[o.offset:]
+	if o.limit != 0 && o.limit < len(entities) {
+		entities = entities[:o.limit]
+	}
+	return entities
+}
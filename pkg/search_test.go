@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestSearchPagination(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "x@example.com"),
+		person("B", "John", "Doe", "x@example.com"),
+		person("C", "Jane", "Roe", "x@example.com"),
+	))
+	assert.NoError(t, err)
+	_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Edges: []dispatcher.DisassembleEdge{{A: "A", B: "B"}, {A: "B", B: "C"}, {A: "A", B: "C"}},
+	})
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		parameters  api.SearchParameters
+		expected    [][]string
+		expectedErr string
+	}{
+		"limit": {
+			parameters: api.SearchParameters{"email": "x@example.com", SearchLimitKey: 1},
+			expected:   [][]string{{"A"}},
+		},
+		"offset": {
+			parameters: api.SearchParameters{"email": "x@example.com", SearchOffsetKey: "1"},
+			expected:   [][]string{{"B"}, {"C"}},
+		},
+		"limit and offset as JSON numbers": {
+			parameters: api.SearchParameters{"email": "x@example.com", SearchOffsetKey: 1.0, SearchLimitKey: 1.0},
+			expected:   [][]string{{"B"}},
+		},
+		"offset beyond results": {
+			parameters: api.SearchParameters{"email": "x@example.com", SearchOffsetKey: 5},
+			expected:   [][]string{},
+		},
+		"invalid limit": {
+			parameters:  api.SearchParameters{"email": "x@example.com", SearchLimitKey: 0},
+			expectedErr: "invalid search parameter _limit 0, must be an integer of at least 1",
+		},
+		"invalid offset": {
+			parameters:  api.SearchParameters{"email": "x@example.com", SearchOffsetKey: 1.5},
+			expectedErr: "invalid search parameter _offset 1.5, must be an integer of at least 0",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			output, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &c.parameters})
+			if c.expectedErr != "" {
+				assert.EqualError(t, err, c.expectedErr)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			actual := [][]string{}
+			for _, entity := range output.Entities {
+				actual = append(actual, ids(entity.Records))
+			}
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestSearchMaxResults(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: testRules, MaxSearchResults: 1}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "John", "Doe", "anna@example.com"),
+		person("C", "Jane", "Roe", "jane@example.com"),
+	))
+	assert.NoError(t, err)
+	_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Edges: []dispatcher.DisassembleEdge{{A: "A", B: "B"}},
+	})
+	assert.NoError(t, err)
+
+	_, err = fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"email": "anna@example.com",
+	}})
+	assert.EqualError(t, err, "search found more than 1 entities, use _limit to limit the results")
+
+	output, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"email":        "anna@example.com",
+		SearchLimitKey: 1,
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, output.Entities, 1)
+}
+
+func TestSearchPaginationWithoutRules(t *testing.T) {
+	fixture := &FakeDispatcher{}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		&api.Record{ID: "B", Data: map[string]interface{}{SearchOffsetKey: 1}},
+	))
+	assert.NoError(t, err)
+
+	output, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"firstName":     "Anna",
+		SearchOffsetKey: 1,
+	}})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Entities)
+
+	output, err = fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"firstName":     "Anna",
+		SearchOffsetKey: 0,
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Entities, 1) {
+		assert.Equal(t, []string{"A"}, ids(output.Entities[0].Records))
+	}
+}
+
+func TestSearchScore(t *testing.T) {
+	fixture := &FakeDispatcher{Rules: []Rule{
+		{ID: "R1", Fields: []string{"firstName", "lastName"}, Compare: map[string]string{"firstName": CompareText, "lastName": CompareText}},
+		{ID: "R2", Fields: []string{"email"}, Weight: 2},
+	}}
+	ctx := context.Background()
+
+	_, err := fixture.Submit(ctx, createSubmitInput(
+		person("A", "ANNA", "SMITH", "smith@example.com"),
+		person("B", "Anna", "Smith", "anna@example.com"),
+		person("C", "John", "Doe", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	_, err = fixture.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Edges: []dispatcher.DisassembleEdge{{A: "A", B: "B"}, {A: "B", B: "C"}},
+	})
+	assert.NoError(t, err)
+
+	output, err := fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"firstName":    "Anna",
+		"lastName":     "Smith",
+		"email":        "anna@example.com",
+		SearchScoreKey: true,
+	}})
+	assert.NoError(t, err)
+	if !assert.Len(t, output.Entities, 3) {
+		return
+	}
+	assert.Equal(t, api.Hits{"B": {"R1", "R2"}, SearchScoreKey: {"3"}}, output.Entities[0].Hits)
+	assert.Equal(t, api.Hits{"C": {"R2"}, SearchScoreKey: {"2"}}, output.Entities[1].Hits)
+	assert.Equal(t, api.Hits{"A": {"R1"}, SearchScoreKey: {"0.5"}}, output.Entities[2].Hits)
+
+	output, err = fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"firstName": "Anna",
+		"lastName":  "Smith",
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, output.Entities, 2) {
+		assert.Equal(t, []string{"B"}, ids(output.Entities[0].Records))
+		assert.Equal(t, api.Hits{"B": {"R1"}}, output.Entities[0].Hits)
+		assert.Equal(t, []string{"A"}, ids(output.Entities[1].Records))
+	}
+
+	_, err = fixture.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		"email":        "anna@example.com",
+		SearchScoreKey: "yes please",
+	}})
+	assert.EqualError(t, err, "invalid search parameter _score yes please, must be a boolean")
+}
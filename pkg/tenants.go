@@ -0,0 +1,336 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+	"gopkg.in/yaml.v3"
+)
+
+// TenantKey is the reserved record data key and search parameter that selects
+// the tenant
+const TenantKey = "_tenant"
+
+// Tenants is a Dispatcher that keeps an isolated FakeDispatcher per tenant
+//
+// For Submit and Search, the tenant is selected using the TenantKey in the
+// record data or in the search parameters, which is removed before forwarding
+// the call. All returned entity IDs, record IDs and edges are qualified with
+// the tenant, e.g. "acme/5c1d...", which selects the tenant for Entity,
+// Disassemble and RemoveConnectionBan.
+//
+// Calls without tenant are forwarded to the default tenant, or fail if there
+// is no default tenant. Calls with an unknown tenant always fail.
+type Tenants struct {
+	// Dispatchers contains the FakeDispatcher for each tenant name
+	Dispatchers map[string]*FakeDispatcher
+
+	// Default is the name of the tenant for calls without tenant, optional
+	Default string
+}
+
+// TenantConfig configures the FakeDispatcher of a single tenant
+type TenantConfig struct {
+	Capacity         int    `yaml:"capacity"`
+	Rules            []Rule `yaml:"rules"`
+	MaxSearchResults int    `yaml:"maxSearchResults"`
+}
+
+// tenantsFile represents the structure of a tenants file
+type tenantsFile struct {
+	Default string                  `yaml:"default"`
+	Tenants map[string]TenantConfig `yaml:"tenants"`
+}
+
+// ParseTenants parses the tenants from YAML (or JSON) data
+//
+// Example:
+//
+//	default: acme
+//	tenants:
+//	  acme:
+//	    capacity: 1000
+//	    maxSearchResults: 100
+//	    rules:
+//	      - id: R1
+//	        fields: [email]
+//	  globex: {}
+func ParseTenants(data []byte) (*Tenants, error) {
+	file := tenantsFile{}
+	err := yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenants: %w", err)
+	}
+	tenants := &Tenants{
+		Dispatchers: make(map[string]*FakeDispatcher, len(file.Tenants)),
+		Default:     file.Default,
+	}
+	// sorted to report the same error for the same data
+	names := make([]string, 0, len(file.Tenants))
+	for name := range file.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		config := file.Tenants[name]
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid tenant name %q, must not be empty or contain a slash", name)
+		}
+		err = ValidateRules(config.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules of tenant %v: %w", name, err)
+		}
+		tenants.Dispatchers[name] = &FakeDispatcher{
+			Capacity:         config.Capacity,
+			Rules:            config.Rules,
+			MaxSearchResults: config.MaxSearchResults,
+		}
+	}
+	if _, ok := tenants.Dispatchers[file.Default]; file.Default != "" && !ok {
+		return nil, fmt.Errorf("default tenant %v does not exist", file.Default)
+	}
+	return tenants, nil
+}
+
+// LoadTenants reads and parses the tenants from the given file
+func LoadTenants(path string) (*Tenants, error) {
+	data, err := os.ReadFile(path) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	return ParseTenants(data)
+}
+
+// Entity forwards the call to the tenant of the qualified entity ID
+func (t *Tenants) Entity(ctx context.Context, input *dispatcher.EntityInput) (*dispatcher.EntityOutput, error) {
+	name, id, err := t.split(input.ID)
+	if err != nil {
+		return nil, err
+	}
+	output, err := t.Dispatchers[name].Entity(ctx, &dispatcher.EntityInput{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	if output.Entity != nil {
+		output.Entity = qualifyEntity(name, output.Entity)
+	}
+	return output, nil
+}
+
+// Submit forwards the records to their tenants
+//
+// Submit fails without any modification if any record has an unknown or no
+// tenant.
+func (t *Tenants) Submit(ctx context.Context, input *dispatcher.SubmitInput) (*dispatcher.SubmitOutput, error) {
+	names := []string{}
+	records := map[string][]*api.Record{}
+	for _, record := range input.Records {
+		name, err := t.tenant(record.Data[TenantKey], "record "+record.ID)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := records[name]; !ok {
+			names = append(names, name)
+		}
+		records[name] = append(records[name], &api.Record{
+			ID:   record.ID,
+			Data: withoutTenant(record.Data),
+		})
+	}
+
+	output := &dispatcher.SubmitOutput{}
+	for _, name := range names {
+		tenantOutput, err := t.Dispatchers[name].Submit(ctx, &dispatcher.SubmitInput{Records: records[name]})
+		if err != nil {
+			return nil, err
+		}
+		output.RecordsAdded += tenantOutput.RecordsAdded
+	}
+	return output, nil
+}
+
+// Search forwards the search to the tenant of the search parameters
+func (t *Tenants) Search(ctx context.Context, input *dispatcher.SearchInput) (*dispatcher.SearchOutput, error) {
+	parameters := api.SearchParameters{}
+	if input.Parameters != nil {
+		parameters = *input.Parameters
+	}
+	name, err := t.tenant(parameters[TenantKey], "search")
+	if err != nil {
+		return nil, err
+	}
+	withoutKey := api.SearchParameters(withoutTenant(parameters))
+	output, err := t.Dispatchers[name].Search(ctx, &dispatcher.SearchInput{Parameters: &withoutKey})
+	if err != nil {
+		return nil, err
+	}
+	for i, entity := range output.Entities {
+		output.Entities[i] = qualifyEntity(name, entity)
+	}
+	return output, nil
+}
+
+// Disassemble forwards the call to the tenant of the qualified record IDs and
+// edges, which must all belong to the same tenant
+func (t *Tenants) Disassemble(ctx context.Context, input *dispatcher.DisassembleInput) (*dispatcher.DisassembleOutput, error) {
+	tenantInput := *input
+	tenantInput.Edges = make([]dispatcher.DisassembleEdge, len(input.Edges))
+	tenantInput.RecordIDs = make([]string, len(input.RecordIDs))
+	ids := make([]*string, 0, len(input.Edges)*2+len(input.RecordIDs))
+	qualified := make([]string, 0, cap(ids))
+	for i, edge := range input.Edges {
+		ids = append(ids, &tenantInput.Edges[i].A, &tenantInput.Edges[i].B)
+		qualified = append(qualified, edge.A, edge.B)
+	}
+	for i, recordID := range input.RecordIDs {
+		ids = append(ids, &tenantInput.RecordIDs[i])
+		qualified = append(qualified, recordID)
+	}
+	name, err := t.splitAll(qualified, ids)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		// neither edges nor records, let the tenant report the invalid input
+		if name, err = t.tenant(nil, "disassemble"); err != nil {
+			return nil, err
+		}
+	}
+
+	output, err := t.Dispatchers[name].Disassemble(ctx, &tenantInput)
+	if err != nil {
+		return nil, err
+	}
+	for i := range output.EntityIDs {
+		output.EntityIDs[i] = qualify(name, output.EntityIDs[i])
+	}
+	return output, nil
+}
+
+// RemoveConnectionBan forwards the call to the tenant of the qualified entity
+// IDs, which must all belong to the same tenant
+func (t *Tenants) RemoveConnectionBan(ctx context.Context, input *dispatcher.RemoveConnectionBanInput) error {
+	tenantInput := *input
+	tenantInput.Others = make([]string, len(input.Others))
+	ids := []*string{&tenantInput.EntityID}
+	for i := range tenantInput.Others {
+		ids = append(ids, &tenantInput.Others[i])
+	}
+	name, err := t.splitAll(append([]string{input.EntityID}, input.Others...), ids)
+	if err != nil {
+		return err
+	}
+	return t.Dispatchers[name].RemoveConnectionBan(ctx, &tenantInput)
+}
+
+// tenant returns the name of the tenant from the TenantKey value or the
+// default tenant if the value is nil
+func (t *Tenants) tenant(value interface{}, subject string) (string, error) {
+	if value == nil {
+		if t.Default == "" {
+			return "", fmt.Errorf("%v has no tenant", subject)
+		}
+		return t.Default, nil
+	}
+	name, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%v has an invalid tenant %v", subject, value)
+	}
+	if _, ok := t.Dispatchers[name]; !ok {
+		return "", fmt.Errorf("unknown tenant %v", name)
+	}
+	return name, nil
+}
+
+// split returns the tenant and the unqualified ID of a qualified ID
+//
+// IDs without a slash belong to the default tenant. IDs with a slash fail
+// unless they are qualified with a known tenant, so that a misspelled tenant
+// never selects another tenant.
+func (t *Tenants) split(qualified string) (string, string, error) {
+	i := strings.Index(qualified, "/")
+	if i < 0 {
+		name, err := t.tenant(nil, qualified)
+		return name, qualified, err
+	}
+	name, err := t.tenant(qualified[:i], qualified)
+	return name, qualified[i+1:], err
+}
+
+// splitAll splits all qualified IDs, stores the unqualified IDs in ids and
+// returns their common tenant
+func (t *Tenants) splitAll(qualified []string, ids []*string) (string, error) {
+	tenant := ""
+	for i, q := range qualified {
+		name, id, err := t.split(q)
+		if err != nil {
+			return "", err
+		}
+		if tenant != "" && name != tenant {
+			return "", fmt.Errorf("%v and %v belong to different tenants", qualified[0], q)
+		}
+		tenant = name
+		*ids[i] = id
+	}
+	return tenant, nil
+}
+
+func qualify(tenant string, id string) string {
+	return tenant + "/" + id
+}
+
+// qualifyEntity returns a copy of the entity where the entity ID, the record
+// IDs and the edges are qualified with the tenant
+//
+// The records are copied as well, since they are still stored in the tenant.
+func qualifyEntity(tenant string, entity *api.Entity) *api.Entity {
+	qualified := &api.Entity{
+		ID:         qualify(tenant, entity.ID),
+		Records:    make([]*api.Record, len(entity.Records)),
+		Edges:      make(api.Edges, len(entity.Edges)),
+		Duplicates: make(api.Duplicates, len(entity.Duplicates)),
+		Hits:       make(api.Hits, len(entity.Hits)),
+	}
+	for i, record := range entity.Records {
+		qualified.Records[i] = &api.Record{ID: qualify(tenant, record.ID), Data: record.Data}
+	}
+	for i, edge := range entity.Edges {
+		parts := strings.SplitN(edge, ":", 3)
+		if len(parts) == 3 {
+			edge = fmt.Sprintf("%v:%v:%v", qualify(tenant, parts[0]), qualify(tenant, parts[1]), parts[2])
+		}
+		qualified.Edges[i] = edge
+	}
+	for original, duplicates := range entity.Duplicates {
+		qualifiedDuplicates := make([]string, len(duplicates))
+		for i, duplicate := range duplicates {
+			qualifiedDuplicates[i] = qualify(tenant, duplicate)
+		}
+		qualified.Duplicates[qualify(tenant, original)] = qualifiedDuplicates
+	}
+	for recordID, ruleIDs := range entity.Hits {
+		if recordID != SearchScoreKey {
+			recordID = qualify(tenant, recordID)
+		}
+		qualified.Hits[recordID] = ruleIDs
+	}
+	return qualified
+}
+
+func withoutTenant(data map[string]interface{}) map[string]interface{} {
+	if _, ok := data[TenantKey]; !ok {
+		return data
+	}
+	c := make(map[string]interface{}, len(data)-1)
+	for k, v := range data {
+		if k != TenantKey {
+			c[k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,176 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+)
+
+func TestParseTenants(t *testing.T) {
+	tenants, err := ParseTenants([]byte(`
+default: acme
+tenants:
+  acme:
+    capacity: 100
+    rules:
+      - id: R1
+        fields: [email]
+  globex: {}
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "acme", tenants.Default)
+	assert.Len(t, tenants.Dispatchers, 2)
+	assert.Equal(t, 100, tenants.Dispatchers["acme"].Capacity)
+	assert.Equal(t, []Rule{{ID: "R1", Fields: []string{"email"}}}, tenants.Dispatchers["acme"].Rules)
+	assert.Empty(t, tenants.Dispatchers["globex"].Rules)
+
+	cases := map[string]struct {
+		data        string
+		expectedErr string
+	}{
+		"unknown default": {
+			data:        "default: unknown\ntenants:\n  acme: {}",
+			expectedErr: "default tenant unknown does not exist",
+		},
+		"slash in name": {
+			data:        "tenants:\n  acme/dev: {}",
+			expectedErr: `invalid tenant name "acme/dev", must not be empty or contain a slash`,
+		},
+		"invalid rules": {
+			data:        "tenants:\n  acme:\n    rules:\n      - id: R1",
+			expectedErr: "invalid rules of tenant acme: rule R1 has no fields",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseTenants([]byte(c.data))
+			assert.EqualError(t, err, c.expectedErr)
+		})
+	}
+}
+
+func TestTenants(t *testing.T) {
+	tenants := &Tenants{
+		Dispatchers: map[string]*FakeDispatcher{
+			"acme":   {Rules: testRules},
+			"globex": {Rules: testRules},
+		},
+	}
+	ctx := context.Background()
+
+	acme := person("A", "Anna", "Smith", "anna@example.com")
+	acme.Data[TenantKey] = "acme"
+	globex := person("A", "John", "Doe", "anna@example.com")
+	globex.Data[TenantKey] = "globex"
+	output, err := tenants.Submit(ctx, createSubmitInput(acme, globex))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, output.RecordsAdded)
+	assert.Equal(t, []string{"A"}, ids(tenants.Dispatchers["acme"].Records()))
+	assert.Equal(t, "Anna", tenants.Dispatchers["acme"].Records()[0].Data["firstName"])
+	assert.NotContains(t, tenants.Dispatchers["acme"].Records()[0].Data, TenantKey)
+	assert.Equal(t, "acme", acme.Data[TenantKey], "submitted records must not be modified")
+
+	searchOutput, err := tenants.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{
+		TenantKey: "globex",
+		"email":   "anna@example.com",
+	}})
+	assert.NoError(t, err)
+	if !assert.Len(t, searchOutput.Entities, 1) {
+		return
+	}
+	entityID := searchOutput.Entities[0].ID
+	assert.Equal(t, "globex/"+tenants.Dispatchers["globex"].Entities()[0].ID, entityID)
+	assert.Equal(t, "John", searchOutput.Entities[0].Records[0].Data["firstName"])
+
+	assert.Equal(t, api.Hits{"globex/A": {"R2"}}, searchOutput.Entities[0].Hits)
+
+	entityOutput, err := tenants.Entity(ctx, &dispatcher.EntityInput{ID: entityID})
+	assert.NoError(t, err)
+	assert.Equal(t, entityID, entityOutput.Entity.ID)
+	assert.Equal(t, "John", entityOutput.Entity.Records[0].Data["firstName"])
+	assert.Equal(t, []string{"globex/A"}, ids(entityOutput.Entity.Records))
+	assert.Equal(t, []string{"A"}, ids(tenants.Dispatchers["globex"].Records()), "stored records must not be modified")
+
+	_, err = tenants.Disassemble(ctx, &dispatcher.DisassembleInput{RecordIDs: []string{"acme/A", "globex/A"}})
+	assert.EqualError(t, err, "acme/A and globex/A belong to different tenants")
+	disassembleOutput, err := tenants.Disassemble(ctx, &dispatcher.DisassembleInput{RecordIDs: []string{"globex/A"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), disassembleOutput.DeletedRecords)
+	assert.Empty(t, tenants.Dispatchers["globex"].Records())
+	assert.Len(t, tenants.Dispatchers["acme"].Records(), 1)
+
+	err = tenants.RemoveConnectionBan(ctx, &dispatcher.RemoveConnectionBanInput{EntityID: "acme/1", Others: []string{"globex/2"}})
+	assert.EqualError(t, err, "acme/1 and globex/2 belong to different tenants")
+}
+
+func TestTenantsWithoutTenant(t *testing.T) {
+	tenants := &Tenants{
+		Dispatchers: map[string]*FakeDispatcher{"acme": {}},
+	}
+	ctx := context.Background()
+
+	_, err := tenants.Submit(ctx, createSubmitInput(record("1")))
+	assert.EqualError(t, err, "record 1 has no tenant")
+	_, err = tenants.Search(ctx, &dispatcher.SearchInput{Parameters: &api.SearchParameters{TenantKey: "unknown"}})
+	assert.EqualError(t, err, "unknown tenant unknown")
+	_, err = tenants.Entity(ctx, &dispatcher.EntityInput{ID: "some-id"})
+	assert.EqualError(t, err, "some-id has no tenant")
+
+	tenants.Default = "acme"
+	_, err = tenants.Submit(ctx, createSubmitInput(record("1")))
+	assert.NoError(t, err)
+	_, err = tenants.Entity(ctx, &dispatcher.EntityInput{ID: "acm/some-id"})
+	assert.EqualError(t, err, "unknown tenant acm", "misspelled tenants must not select the default tenant")
+	_, err = tenants.Disassemble(ctx, &dispatcher.DisassembleInput{RecordIDs: []string{"acm/1"}})
+	assert.EqualError(t, err, "unknown tenant acm")
+	assert.Len(t, tenants.Dispatchers["acme"].Records(), 1)
+	entityOutput, err := tenants.Entity(ctx, &dispatcher.EntityInput{ID: "some-id"})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/some-id", entityOutput.Entity.ID)
+	assert.Len(t, entityOutput.Entity.Records, 1)
+}
+
+func TestTenantsQualifiedEdges(t *testing.T) {
+	tenants := &Tenants{
+		Dispatchers: map[string]*FakeDispatcher{"acme": {Rules: testRules}},
+		Default:     "acme",
+	}
+	ctx := context.Background()
+	_, err := tenants.Submit(ctx, createSubmitInput(
+		person("A", "Anna", "Smith", "anna@example.com"),
+		person("B", "Anna", "Smith", "anna@example.com"),
+		person("C", "Ann", "Smith", "anna@example.com"),
+	))
+	assert.NoError(t, err)
+	entityID := "acme/" + tenants.Dispatchers["acme"].Entities()[0].ID
+
+	entityOutput, err := tenants.Entity(ctx, &dispatcher.EntityInput{ID: entityID})
+	if !assert.NoError(t, err) {
+		return
+	}
+	entity := entityOutput.Entity
+	assert.Equal(t, []string{"acme/A", "acme/B", "acme/C"}, ids(entity.Records))
+	assert.Contains(t, entity.Edges, "acme/A:acme/C:R2")
+	assert.Equal(t, api.Duplicates{"acme/A": {"acme/B"}}, entity.Duplicates)
+
+	// edges of returned entities can be passed to Disassemble
+	output, err := tenants.Disassemble(ctx, &dispatcher.DisassembleInput{
+		Edges: []dispatcher.DisassembleEdge{{A: "acme/A", B: "acme/C"}, {A: "acme/B", B: "acme/C"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), output.DeletedEdges)
+	assert.Len(t, output.EntityIDs, 2)
+}
+
+func TestParseTenantsReportsFirstInvalidTenant(t *testing.T) {
+	data := []byte("tenants:\n  c/x: {}\n  b/x: {}\n  a/x: {}\n  d/x: {}")
+	for i := 0; i < 10; i++ {
+		_, err := ParseTenants(data)
+		assert.EqualError(t, err, `invalid tenant name "a/x", must not be empty or contain a slash`)
+	}
+}
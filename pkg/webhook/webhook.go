@@ -0,0 +1,216 @@
+// Package webhook delivers the entity change events of a fake dispatcher to an
+// HTTP endpoint.
+//
+// Events are sent in batches as JSON object with an events array. If a secret
+// is configured, each request contains the hex encoded HMAC-SHA256 signature of
+// the request body in the X-Fake-Dispatcher-Signature header, prefixed with
+// "sha256=". Failed deliveries are retried using exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg"
+)
+
+// SignatureHeader is the HTTP header that contains the signature of the body
+const SignatureHeader = "X-Fake-Dispatcher-Signature"
+
+// defaults for unset Webhook fields
+const (
+	DefaultBatchSize      = 100
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = time.Second
+	DefaultTimeout        = 10 * time.Second
+)
+
+// EventSource provides the events, e.g. a *pkg.FakeDispatcher or a *pkg.Admin
+type EventSource interface {
+	Events(ctx context.Context, input *pkg.EventsInput) (*pkg.EventsOutput, error)
+}
+
+// Batch is the body of each webhook request
+type Batch struct {
+	Events []pkg.Event `json:"events"`
+}
+
+// Webhook delivers events to the configured URL
+type Webhook struct {
+	// URL receives the events using POST requests
+	URL string
+
+	// Secret is used for signing the requests, requests are not signed if
+	// empty
+	Secret string
+
+	// BatchSize is the maximum number of events per request, defaults to 100
+	BatchSize int
+
+	// MaxAttempts is the maximum number of attempts per batch, defaults to 5
+	MaxAttempts int
+
+	// InitialBackoff is the wait time before the first retry, which doubles
+	// for each further retry, defaults to one second
+	InitialBackoff time.Duration
+
+	// Client is used for sending the requests, defaults to a client with a
+	// timeout of 10 seconds
+	Client *http.Client
+
+	// OnError is called with the error if a batch could not be delivered
+	// after all attempts, the batch will then be skipped
+	OnError func(err error)
+}
+
+// Run delivers all events of the source until the context is done
+//
+// Run always returns a non-nil error, which is the context error once the
+// context is done.
+func (w *Webhook) Run(ctx context.Context, source EventSource) error {
+	timeout := pkg.MaxEventsTimeout
+	cursor := int64(0)
+	for {
+		output, err := source.Events(ctx, &pkg.EventsInput{
+			After:   cursor,
+			Limit:   w.batchSize(),
+			Timeout: &timeout,
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			w.reportError(fmt.Errorf("failed to read events: %w", err))
+			if !sleep(ctx, w.initialBackoff()) {
+				return ctx.Err()
+			}
+			continue
+		}
+		if len(output.Events) == 0 {
+			continue
+		}
+		err = w.Deliver(ctx, output.Events)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			w.reportError(err)
+		}
+		cursor = output.Cursor
+	}
+}
+
+// Deliver sends the events as a single batch, retrying failed attempts
+//
+// A delivery fails if the request cannot be sent or if the response status is
+// not 2xx.
+func (w *Webhook) Deliver(ctx context.Context, events []pkg.Event) error {
+	body, err := json.Marshal(Batch{Events: events})
+	if err != nil {
+		return err
+	}
+	backoff := w.initialBackoff()
+	for attempt := 1; ; attempt++ {
+		err = w.send(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= w.maxAttempts() {
+			return fmt.Errorf("failed to deliver %v events after %v attempts: %w", len(events), attempt, err)
+		}
+		if !sleep(ctx, backoff) {
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	resp, err := w.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()               // nolint:errcheck
+	_, _ = io.Copy(io.Discard, resp.Body) // allows reusing the connection
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature of the body as used in the SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if the signature matches the body
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func (w *Webhook) reportError(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+func (w *Webhook) batchSize() int {
+	if w.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return w.BatchSize
+}
+
+func (w *Webhook) maxAttempts() int {
+	if w.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return w.MaxAttempts
+}
+
+func (w *Webhook) initialBackoff() time.Duration {
+	if w.InitialBackoff <= 0 {
+		return DefaultInitialBackoff
+	}
+	return w.InitialBackoff
+}
+
+var defaultClient = &http.Client{Timeout: DefaultTimeout}
+
+func (w *Webhook) client() *http.Client {
+	if w.Client == nil {
+		return defaultClient
+	}
+	return w.Client
+}
+
+// sleep waits for the given duration and returns false if the context is done
+// before
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	api "github.com/tilotech/tilores-plugin-api"
+	"github.com/tilotech/tilores-plugin-api/dispatcher"
+	"github.com/tilotech/tilores-plugin-fake-dispatcher/pkg"
+)
+
+// receiver is a webhook endpoint that fails the first failures requests
+type receiver struct {
+	secret   string
+	failures int
+
+	mu       sync.Mutex
+	requests int
+	events   []pkg.Event
+	invalid  int
+	received chan struct{}
+}
+
+func newReceiver(secret string, failures int) *receiver {
+	return &receiver{
+		secret:   secret,
+		failures: failures,
+		received: make(chan struct{}, 100),
+	}
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	if r.requests <= r.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	if !Verify(r.secret, body, req.Header.Get(SignatureHeader)) {
+		r.invalid++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	batch := Batch{}
+	_ = json.Unmarshal(body, &batch)
+	r.events = append(r.events, batch.Events...)
+	r.received <- struct{}{}
+}
+
+func TestDeliver(t *testing.T) {
+	r := newReceiver("secret", 2)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	w := &Webhook{URL: server.URL, Secret: "secret", InitialBackoff: time.Millisecond}
+	events := []pkg.Event{{Sequence: 1, Type: pkg.EventRecordAdded, RecordID: "1"}}
+	err := w.Deliver(context.Background(), events)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, r.requests)
+	assert.Equal(t, events, r.events)
+}
+
+func TestDeliverFailsAfterMaxAttempts(t *testing.T) {
+	r := newReceiver("secret", 10)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	w := &Webhook{URL: server.URL, Secret: "secret", MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	err := w.Deliver(context.Background(), []pkg.Event{{Sequence: 1}})
+	assert.EqualError(t, err, "failed to deliver 1 events after 3 attempts: unexpected status 503 Service Unavailable")
+	assert.Equal(t, 3, r.requests)
+}
+
+func TestDeliverWithWrongSecret(t *testing.T) {
+	r := newReceiver("secret", 0)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	w := &Webhook{URL: server.URL, Secret: "wrong", MaxAttempts: 1}
+	err := w.Deliver(context.Background(), []pkg.Event{{Sequence: 1}})
+	assert.Error(t, err)
+	assert.Equal(t, 1, r.invalid)
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", Sign("key", []byte("The quick brown fox jumps over the lazy dog")))
+	assert.True(t, Verify("key", []byte("body"), Sign("key", []byte("body"))))
+	assert.False(t, Verify("key", []byte("body"), Sign("other", []byte("body"))))
+}
+
+func TestRun(t *testing.T) {
+	r := newReceiver("secret", 1)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	fake := &pkg.FakeDispatcher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Webhook{URL: server.URL, Secret: "secret", InitialBackoff: time.Millisecond}
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx, fake)
+	}()
+
+	_, err := fake.Submit(ctx, &dispatcher.SubmitInput{Records: []*api.Record{{ID: "1"}, {ID: "2"}}})
+	assert.NoError(t, err)
+	select {
+	case <-r.received:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no events received")
+	}
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if assert.Len(t, r.events, 2) {
+		assert.Equal(t, "1", r.events[0].RecordID)
+		assert.Equal(t, "2", r.events[1].RecordID)
+	}
+}